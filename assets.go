@@ -0,0 +1,9 @@
+package main
+
+import "embed"
+
+// assets holds the templates and the static files, so that the binary runs
+// from any directory
+//
+//go:embed templates public
+var assets embed.FS
@@ -0,0 +1,398 @@
+// Package config loads the configuration of the server from a JSON file, env
+// variables and command-line flags. Flags take precedence over env variables,
+// which take precedence over the file, which takes precedence over the
+// defaults.
+//
+// Usage
+//
+//	cfg, args, err := config.Load(os.Args[1:])
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/gin-gonic/gin"
+	"github.com/madhums/go-gin-mgo-demo/db"
+)
+
+const (
+	// Redacted replaces secrets when printing the configuration
+	Redacted = "REDACTED"
+)
+
+// Config is the configuration of the server
+type Config struct {
+	Port            string   `json:"port"`
+	BasePath        string   `json:"base_path"`
+	PublicDir       string   `json:"public_dir"`
+	Embed           bool     `json:"embed"`
+	SessionSecret   string   `json:"session_secret"`
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+
+	Database  Database  `json:"database"`
+	Templates Templates `json:"templates"`
+}
+
+// Database configures how the server reaches its database
+type Database struct {
+	URL      string   `json:"url"`
+	Timeout  Duration `json:"timeout"`
+	Retries  int      `json:"retries"`
+	Degraded bool     `json:"degraded"`
+
+	// Mode is the consistency mode of the mongo session and ReadMode the one
+	// of the routes listing and searching articles, see db.SessionOptions
+	Mode          string   `json:"mode"`
+	ReadMode      string   `json:"read_mode"`
+	Write         Write    `json:"write"`
+	PoolLimit     int      `json:"pool_limit"`
+	SocketTimeout Duration `json:"socket_timeout"`
+}
+
+// Write is the write concern of mongo, see mgo.Safe
+type Write struct {
+	W        int      `json:"w"`
+	WMode    string   `json:"wmode"`
+	WTimeout Duration `json:"wtimeout"`
+	J        bool     `json:"j"`
+}
+
+// Templates configures the html renderer
+type Templates struct {
+	Dir    string `json:"dir"`
+	Layout string `json:"layout"`
+	Ext    string `json:"ext"`
+	Debug  bool   `json:"debug"`
+}
+
+// Duration is a time.Duration written like `10s` in the file
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations must be strings like \"10s\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	d.Duration = v
+	return err
+}
+
+// Default returns the configuration used for everything that is not set
+func Default() *Config {
+	return &Config{
+		Port:            "7000",
+		PublicDir:       "./public",
+		Embed:           true,
+		ShutdownTimeout: Duration{15 * time.Second},
+		Database: Database{
+			URL:     db.MongoDBUrl,
+			Timeout: Duration{10 * time.Second},
+			Retries: 5,
+			Mode:    db.Strong,
+		},
+		Templates: Templates{
+			Dir:    "templates/",
+			Layout: "layouts/default",
+			Ext:    ".html",
+			Debug:  gin.IsDebugging(),
+		},
+	}
+}
+
+// setting is an option that can be set by an env variable and a flag
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value flag.Value
+}
+
+// settings returns the options of the configuration, pointing into it
+func (c *Config) settings() []setting {
+	return []setting{
+		{"port", "PORT", "port to listen on", (*stringValue)(&c.Port)},
+		{"base-path", "BASE_PATH", "path the app is served under, e.g. /blog", (*stringValue)(&c.BasePath)},
+		{"public-dir", "PUBLIC_DIR", "directory of the static files", (*stringValue)(&c.PublicDir)},
+		{"embed", "EMBED_ASSETS", "serve the templates and static files embedded in the binary", (*boolValue)(&c.Embed)},
+		{"session-secret", "SESSION_SECRET", "key the session cookies are signed with", (*stringValue)(&c.SessionSecret)},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "time requests get to finish on shutdown", (*durationValue)(&c.ShutdownTimeout.Duration)},
+		{"mongodb-url", "MONGODB_URL", "url of the database: mongodb://, memory:// or file://", (*stringValue)(&c.Database.URL)},
+		{"mongodb-timeout", "MONGODB_TIMEOUT", "timeout of each attempt to reach mongo", (*durationValue)(&c.Database.Timeout.Duration)},
+		{"mongodb-retries", "MONGODB_RETRIES", "number of retries to reach mongo on start", (*intValue)(&c.Database.Retries)},
+		{"mongodb-degraded", "MONGODB_DEGRADED", "start without mongo if it can't be reached", (*boolValue)(&c.Database.Degraded)},
+		{"mongodb-mode", "MONGODB_MODE", "consistency mode: strong, monotonic or eventual", (*stringValue)(&c.Database.Mode)},
+		{"mongodb-read-mode", "MONGODB_READ_MODE", "consistency mode of the routes listing and searching articles", (*stringValue)(&c.Database.ReadMode)},
+		{"mongodb-w", "MONGODB_W", "number of servers that must acknowledge writes", (*intValue)(&c.Database.Write.W)},
+		{"mongodb-wmode", "MONGODB_WMODE", "write mode, e.g. majority, instead of -mongodb-w", (*stringValue)(&c.Database.Write.WMode)},
+		{"mongodb-wtimeout", "MONGODB_WTIMEOUT", "time to wait for the servers to acknowledge writes", (*durationValue)(&c.Database.Write.WTimeout.Duration)},
+		{"mongodb-journal", "MONGODB_JOURNAL", "wait for writes to be journaled", (*boolValue)(&c.Database.Write.J)},
+		{"mongodb-pool-limit", "MONGODB_POOL_LIMIT", "maximum number of sockets per mongo server", (*intValue)(&c.Database.PoolLimit)},
+		{"mongodb-socket-timeout", "MONGODB_SOCKET_TIMEOUT", "time to wait for mongo to respond", (*durationValue)(&c.Database.SocketTimeout.Duration)},
+		{"templates-dir", "TEMPLATES_DIR", "directory of the templates", (*stringValue)(&c.Templates.Dir)},
+		{"templates-layout", "TEMPLATES_LAYOUT", "template every page is rendered in", (*stringValue)(&c.Templates.Layout)},
+		{"templates-ext", "TEMPLATES_EXT", "file extension of the templates", (*stringValue)(&c.Templates.Ext)},
+		{"debug", "TEMPLATES_DEBUG", "reload the templates on every request", (*boolValue)(&c.Templates.Debug)},
+	}
+}
+
+// Load returns the configuration set by the file named by the -config flag
+// or the CONFIG_FILE env variable, the env variables and the flags in args,
+// and the arguments left after the flags
+func Load(args []string) (*Config, []string, error) {
+	c := Default()
+	settings := c.settings()
+
+	// Flags are applied last but parsed first, as they name the file
+	fs := flag.NewFlagSet("go-gin-mgo-demo", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "JSON configuration file")
+	flags := map[string]*rawValue{}
+	for _, s := range settings {
+		raw := &rawValue{bool: isBool(s.value)}
+		flags[s.flag] = raw
+		fs.Var(raw, s.flag, s.usage+" ($"+s.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if len(*file) > 0 {
+		if err := c.readFile(*file); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if v := os.Getenv(s.env); len(v) > 0 {
+			if err := s.value.Set(v); err != nil {
+				return nil, nil, fmt.Errorf("invalid %s %q", s.env, v)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		raw, ok := flags[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		for _, s := range settings {
+			if s.flag == f.Name && s.value.Set(raw.value) != nil {
+				err = fmt.Errorf("invalid -%s %q", f.Name, raw.value)
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, fs.Args(), c.Validate()
+}
+
+// readFile sets the options found in the JSON file. Unknown options are
+// reported to catch typos.
+func (c *Config) readFile(name string) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("can't read the config file: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("can't read the config file %s: %v", name, err)
+	}
+	return nil
+}
+
+// Validate reports the first invalid option
+func (c *Config) Validate() error {
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %q", c.Port)
+	}
+	if len(c.BasePath) > 0 && (!strings.HasPrefix(c.BasePath, "/") || strings.HasSuffix(c.BasePath, "/")) {
+		return fmt.Errorf("base path %q must start and must not end with /", c.BasePath)
+	}
+	if c.ShutdownTimeout.Duration <= 0 {
+		return errors.New("shutdown timeout must be positive")
+	}
+
+	switch {
+	case strings.HasPrefix(c.Database.URL, "mongodb://"):
+	case strings.HasPrefix(c.Database.URL, db.MemoryScheme):
+	case strings.HasPrefix(c.Database.URL, db.FileScheme):
+		if len(strings.TrimPrefix(c.Database.URL, db.FileScheme)) == 0 {
+			return errors.New("file:// database url needs a path")
+		}
+	default:
+		return fmt.Errorf("database url %q must start with mongodb://, %s or %s", redactURL(c.Database.URL), db.MemoryScheme, db.FileScheme)
+	}
+	if c.Database.Timeout.Duration <= 0 {
+		return errors.New("database timeout must be positive")
+	}
+	if c.Database.Retries < 0 {
+		return errors.New("database retries must not be negative")
+	}
+	if c.Database.Write.W > 0 && len(c.Database.Write.WMode) > 0 {
+		return errors.New("database write w and wmode must not both be set")
+	}
+	if c.Database.Write.WTimeout.Duration < 0 || c.Database.SocketTimeout.Duration < 0 {
+		return errors.New("database timeouts must not be negative")
+	}
+	if err := c.DBOptions().Session.Validate(); err != nil {
+		return err
+	}
+	if err := c.ReadSession().Validate(); err != nil {
+		return err
+	}
+
+	// Embedded templates are read from disk in debug mode only if they exist
+	if !c.Embedded() {
+		if info, err := os.Stat(c.Templates.Dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("templates dir %q does not exist", c.Templates.Dir)
+		}
+		if info, err := os.Stat(c.PublicDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("public dir %q does not exist", c.PublicDir)
+		}
+	}
+	if len(c.Templates.Layout) == 0 || len(c.Templates.Ext) == 0 {
+		return errors.New("templates layout and ext must be set")
+	}
+	return nil
+}
+
+// Embedded reports whether the server uses the templates and static files
+// embedded in the binary. They only hold the default dirs, so other dirs are
+// always read from disk.
+func (c *Config) Embedded() bool {
+	defaults := Default()
+	return c.Embed &&
+		path.Clean(c.Templates.Dir) == path.Clean(defaults.Templates.Dir) &&
+		path.Clean(c.PublicDir) == path.Clean(defaults.PublicDir)
+}
+
+// DBOptions returns the options db.Connect reaches the database with
+func (c *Config) DBOptions() db.Options {
+	return db.Options{
+		URL:        c.Database.URL,
+		Timeout:    c.Database.Timeout.Duration,
+		Retries:    c.Database.Retries,
+		Backoff:    time.Second,
+		MaxBackoff: 30 * time.Second,
+		Degraded:   c.Database.Degraded,
+		Session: db.SessionOptions{
+			Mode: c.Database.Mode,
+			Safe: &mgo.Safe{
+				W:        c.Database.Write.W,
+				WMode:    c.Database.Write.WMode,
+				WTimeout: int(c.Database.Write.WTimeout.Duration / time.Millisecond),
+				J:        c.Database.Write.J,
+			},
+			PoolLimit:     c.Database.PoolLimit,
+			SocketTimeout: c.Database.SocketTimeout.Duration,
+		},
+	}
+}
+
+// ReadSession returns the options of the mongo session of the routes listing
+// and searching articles
+func (c *Config) ReadSession() db.SessionOptions {
+	return db.SessionOptions{Mode: c.Database.ReadMode}
+}
+
+// Redacted returns a copy of the configuration without secrets, to be shown
+func (c *Config) Redacted() *Config {
+	r := *c
+	if len(r.SessionSecret) > 0 {
+		r.SessionSecret = Redacted
+	}
+	r.Database.URL = redactURL(r.Database.URL)
+	return &r
+}
+
+// redactURL replaces the password in the url
+func redactURL(s string) string {
+	scheme := strings.Index(s, "://")
+	if scheme < 0 {
+		return s
+	}
+	rest := s[scheme+3:]
+	if slash := strings.Index(rest, "/"); slash >= 0 {
+		rest = rest[:slash]
+	}
+	at := strings.LastIndex(rest, "@")
+	if at < 0 {
+		return s
+	}
+	colon := strings.Index(rest[:at], ":")
+	if colon < 0 {
+		return s
+	}
+	return s[:scheme+3+colon+1] + Redacted + s[scheme+3+at:]
+}
+
+// rawValue holds the value of a flag until it is applied
+type rawValue struct {
+	value string
+	bool  bool
+}
+
+func (v *rawValue) String() string     { return v.value }
+func (v *rawValue) Set(s string) error { v.value = s; return nil }
+func (v *rawValue) IsBoolFlag() bool   { return v.bool }
+
+func isBool(v flag.Value) bool {
+	_, ok := v.(*boolValue)
+	return ok
+}
+
+type stringValue string
+
+func (v *stringValue) String() string     { return string(*v) }
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+
+type intValue int
+
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+func (v *intValue) Set(s string) error {
+	i, err := strconv.Atoi(s)
+	*v = intValue(i)
+	return err
+}
+
+type boolValue bool
+
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	*v = boolValue(b)
+	return err
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	*v = durationValue(d)
+	return err
+}
@@ -1,42 +1,232 @@
 package db
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/mgo.v2"
+
+	"github.com/madhums/go-gin-mgo-demo/models"
 )
 
 var (
-	// Session stores mongo session
+	// Session stores mongo session. It is nil until Connect reached mongo,
+	// use Clone to get a session for a request.
 	Session *mgo.Session
 
 	// Mongo stores the mongodb connection string information
 	Mongo *mgo.DialInfo
+
+	// Shared stores the backend for memory:// and file:// urls, whose stores
+	// are shared by all requests. Session and Mongo are nil then.
+	Shared Backend
+
+	// ErrUnavailable is returned by Clone while mongo can not be reached
+	ErrUnavailable = errors.New("database unavailable")
+
+	// mu guards Session and Mongo, which are set in the background in
+	// degraded mode
+	mu sync.RWMutex
 )
 
+// Backend is a storage backend whose stores are shared by all requests
+type Backend interface {
+	// Stores returns the article and user stores of the backend
+	Stores() (models.ArticleStore, models.UserStore)
+
+	// Close releases the backend once the server stops
+	Close() error
+}
+
 const (
 	// MongoDBUrl is the default mongodb url that will be used to connect to the
 	// database.
 	MongoDBUrl = "mongodb://localhost:27017/articles_demo_dev"
+
+	// MemoryScheme is the scheme of urls selecting the in-memory stores. The
+	// rest of the url is the optional path of the JSON file the stores are
+	// loaded from and saved to, e.g. memory://articles.json
+	MemoryScheme = "memory://"
+
+	// FileScheme is the scheme of urls selecting the stores kept in a single
+	// key/value file. The rest of the url is the path of the file, e.g.
+	// file:///var/lib/articles/articles.db
+	FileScheme = "file://"
 )
 
-// Connect connects to mongodb
-func Connect() {
-	uri := os.Getenv("MONGODB_URL")
+// Options configure how Connect reaches the database
+type Options struct {
+	// URL of the database, see MongoDBUrl, MemoryScheme and FileScheme
+	URL string
+
+	// Timeout of each attempt to reach mongo
+	Timeout time.Duration
+
+	// Retries is the number of attempts after the first one before Connect
+	// gives up. The wait between attempts starts at Backoff and doubles up
+	// to MaxBackoff.
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Degraded lets Connect return without mongo once the retries are used
+	// up. It keeps trying in the background while Clone reports
+	// ErrUnavailable.
+	Degraded bool
+
+	// Session tunes the consistency mode, write concern, pool and timeouts
+	// of the mongo session
+	Session SessionOptions
 
-	if len(uri) == 0 {
-		uri = MongoDBUrl
+	// OnConnect is called once mongo is reached, e.g. to ensure indexes
+	OnConnect func() error
+}
+
+// Connect connects to mongodb, or opens the in-memory stores for memory://
+// urls and the file stores for file:// urls. Mongo is retried with backoff
+// and an error is returned if it can't be reached, unless the options allow
+// running degraded.
+func Connect(options Options) error {
+	uri := options.URL
+
+	if strings.HasPrefix(uri, MemoryScheme) {
+		memory, err := OpenMemory(strings.TrimPrefix(uri, MemoryScheme))
+		if err != nil {
+			return fmt.Errorf("can't open the in-memory store: %v", err)
+		}
+		fmt.Println("Using the in-memory store", uri)
+		Shared = memory
+		return nil
+	}
+
+	if strings.HasPrefix(uri, FileScheme) {
+		file, err := OpenFile(strings.TrimPrefix(uri, FileScheme))
+		if err != nil {
+			return fmt.Errorf("can't open the file store: %v", err)
+		}
+		fmt.Println("Using the file store", uri)
+		Shared = file
+		return nil
 	}
 
 	mongo, err := mgo.ParseURL(uri)
-	s, err := mgo.Dial(uri)
 	if err != nil {
-		fmt.Printf("Can't connect to mongo, go error %v\n", err)
-		panic(err.Error())
+		return fmt.Errorf("invalid mongodb url %q: %v", uri, err)
+	}
+	mongo.Timeout = options.Timeout
+	if err := options.Session.Validate(); err != nil {
+		return err
+	}
+
+	backoff := options.Backoff
+	for attempt := 0; ; attempt++ {
+		err = dial(mongo, options.Session)
+		if err == nil {
+			return options.onConnect()
+		}
+		if attempt == options.Retries {
+			break
+		}
+		fmt.Printf("Can't connect to mongo (attempt %d of %d), retrying in %v, go error %v\n", attempt+1, options.Retries+1, backoff, err)
+		time.Sleep(backoff)
+		backoff = nextBackoff(backoff, options.MaxBackoff)
+	}
+
+	if !options.Degraded {
+		return fmt.Errorf("can't connect to mongo at %s after %d attempts: %v", redact(mongo), options.Retries+1, err)
+	}
+
+	fmt.Printf("Can't connect to mongo, starting without database, go error %v\n", err)
+	go func() {
+		for dial(mongo, options.Session) != nil {
+			time.Sleep(backoff)
+			backoff = nextBackoff(backoff, options.MaxBackoff)
+		}
+		if err := options.onConnect(); err != nil {
+			fmt.Printf("Can't prepare the database, go error %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// dial connects to mongo and sets Session and Mongo
+func dial(mongo *mgo.DialInfo, options SessionOptions) error {
+	s, err := mgo.DialWithInfo(mongo)
+	if err != nil {
+		return err
 	}
 	s.SetSafe(&mgo.Safe{})
-	fmt.Println("Connected to", uri)
+	options.apply(s)
+	fmt.Println("Connected to", redact(mongo))
+
+	mu.Lock()
 	Session = s
 	Mongo = mongo
+	mu.Unlock()
+	return nil
+}
+
+func (o Options) onConnect() error {
+	if o.OnConnect == nil {
+		return nil
+	}
+	return o.OnConnect()
+}
+
+// Clone returns a copy of the mongo session to be closed after use, or
+// ErrUnavailable while mongo has not been reached
+func Clone() (*mgo.Session, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if Session == nil {
+		return nil, ErrUnavailable
+	}
+	return Session.Clone(), nil
+}
+
+// Ping checks that the database can be reached. Shared backends are always
+// reachable.
+func Ping() error {
+	if Shared != nil {
+		return nil
+	}
+
+	s, err := Clone()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Ping()
+}
+
+// Close closes the shared backend, which saves the in-memory stores, or the
+// mongo session
+func Close() error {
+	if Shared != nil {
+		return Shared.Close()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if Session != nil {
+		Session.Close()
+	}
+	return nil
+}
+
+func nextBackoff(backoff, limit time.Duration) time.Duration {
+	backoff *= 2
+	if limit > 0 && backoff > limit {
+		return limit
+	}
+	return backoff
+}
+
+// redact returns the hosts and database of the dial info without credentials
+func redact(mongo *mgo.DialInfo) string {
+	return strings.Join(mongo.Addrs, ",") + "/" + mongo.Database
 }
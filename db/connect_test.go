@@ -0,0 +1,42 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnectErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		message string
+	}{
+		{"invalid url", "mongodb://localhost:27017/db?nope=1", "invalid mongodb url"},
+		{"unreachable", "mongodb://127.0.0.1:1/db", "after 2 attempts"},
+	}
+	for _, tt := range tests {
+		err := Connect(Options{
+			URL:     tt.url,
+			Timeout: 100 * time.Millisecond,
+			Retries: 1,
+			Backoff: time.Millisecond,
+		})
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.message)
+		}
+	}
+
+	if _, err := Clone(); err != ErrUnavailable {
+		t.Errorf("got error %v from Clone, want ErrUnavailable", err)
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	if got := nextBackoff(time.Second, 30*time.Second); got != 2*time.Second {
+		t.Errorf("got %v, want 2s", got)
+	}
+	if got := nextBackoff(20*time.Second, 30*time.Second); got != 30*time.Second {
+		t.Errorf("got %v, want 30s", got)
+	}
+}
@@ -0,0 +1,373 @@
+package db
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+// FileArticles is an ArticleStore keeping the articles in a key/value file.
+// An index of updated_on and _id lists articles in the default order without
+// reading them all. It is safe for concurrent use.
+type FileArticles struct {
+	mu      sync.RWMutex
+	kv      *kv
+	updated []updatedKey
+}
+
+// updatedKey is an entry of the updated_on index, which is sorted ascending
+type updatedKey struct {
+	UpdatedOn time.Time
+	Id        bson.ObjectId
+}
+
+func (k updatedKey) less(other updatedKey) bool {
+	if !k.UpdatedOn.Equal(other.UpdatedOn) {
+		return k.UpdatedOn.Before(other.UpdatedOn)
+	}
+	return k.Id < other.Id
+}
+
+func newFileArticles(store *kv) (*FileArticles, error) {
+	s := &FileArticles{kv: store}
+	err := store.each(models.CollectionArticle, func(key string, value []byte) error {
+		article := models.Article{}
+		if err := json.Unmarshal(value, &article); err != nil {
+			return err
+		}
+		s.updated = append(s.updated, updatedKey{article.UpdatedOn, article.Id})
+		return nil
+	})
+	sort.Slice(s.updated, func(i, j int) bool {
+		return s.updated[i].less(s.updated[j])
+	})
+	return s, err
+}
+
+// Get implements models.ArticleStore
+func (s *FileArticles) Get(id bson.ObjectId) (models.Article, error) {
+	article := models.Article{}
+	value, ok := s.kv.get(models.CollectionArticle, id.Hex())
+	if !ok {
+		return article, models.ErrNotFound
+	}
+	err := json.Unmarshal(value, &article)
+	return article, err
+}
+
+// List implements models.ArticleStore. Lists sorted by updated_on walk the
+// index and only read the articles of the page.
+func (s *FileArticles) List(q models.ArticleQuery) ([]models.Article, bool, error) {
+	if q.SortField() != "updated_on" {
+		articles, err := s.all(q)
+		if err != nil {
+			return nil, false, err
+		}
+		articles, more := page(articles, q)
+		return articles, more, nil
+	}
+
+	s.mu.RLock()
+	keys := s.matchingKeys(q)
+	s.mu.RUnlock()
+
+	skip := q.Skip()
+	if skip < 0 || skip > len(keys) {
+		skip = len(keys)
+	}
+	keys = keys[skip:]
+	more := len(keys) > q.Limit
+	if more {
+		keys = keys[:q.Limit]
+	}
+
+	articles := make([]models.Article, 0, len(keys))
+	for _, key := range keys {
+		article, err := s.Get(key.Id)
+		if err == models.ErrNotFound {
+			// Deleted since the index was read
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		articles = append(articles, article)
+	}
+	return articles, more, nil
+}
+
+// Count implements models.ArticleStore using the index
+func (s *FileArticles) Count(q models.ArticleQuery) (int, error) {
+	q.Cursor = nil
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.matchingKeys(q)), nil
+}
+
+// Search implements models.ArticleStore
+func (s *FileArticles) Search(text string, q models.ArticleQuery) ([]models.SearchResult, int, error) {
+	articles, err := s.all(models.ArticleQuery{})
+	if err != nil {
+		return nil, 0, err
+	}
+	results, total := search(articles, text, q)
+	return results, total, nil
+}
+
+// Create implements models.ArticleStore
+func (s *FileArticles) Create(article *models.Article) error {
+	article.BeforeInsert()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.kv.get(models.CollectionArticle, article.Id.Hex()); ok {
+		return models.ErrConflict
+	}
+	if err := s.put(*article); err != nil {
+		return err
+	}
+	s.insertKey(updatedKey{article.UpdatedOn, article.Id})
+	return nil
+}
+
+// Update implements models.ArticleStore
+func (s *FileArticles) Update(stored models.Article, article *models.Article) (*models.Article, error) {
+	doc, err := article.ChangesFrom(stored)
+	if err == models.ErrConflict {
+		return &stored, err
+	}
+	if err != nil || doc == nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.Get(stored.Id)
+	if err != nil {
+		return nil, err
+	}
+	if current.Version != stored.Version {
+		return &current, models.ErrConflict
+	}
+	if err := s.put(*article); err != nil {
+		return nil, err
+	}
+	s.removeKey(updatedKey{current.UpdatedOn, current.Id})
+	s.insertKey(updatedKey{article.UpdatedOn, article.Id})
+	return nil, nil
+}
+
+// Delete implements models.ArticleStore
+func (s *FileArticles) Delete(id bson.ObjectId) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	article, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.kv.delete(models.CollectionArticle, id.Hex()); err != nil {
+		return err
+	}
+	s.removeKey(updatedKey{article.UpdatedOn, article.Id})
+	return nil
+}
+
+func (s *FileArticles) put(article models.Article) error {
+	value, err := json.Marshal(article)
+	if err != nil {
+		return err
+	}
+	return s.kv.put(models.CollectionArticle, article.Id.Hex(), value)
+}
+
+// all returns the articles matching the query in the order of the query
+func (s *FileArticles) all(q models.ArticleQuery) ([]models.Article, error) {
+	articles := []models.Article{}
+	err := s.kv.each(models.CollectionArticle, func(key string, value []byte) error {
+		article := models.Article{}
+		if err := json.Unmarshal(value, &article); err != nil {
+			return err
+		}
+		if q.Match(article) {
+			articles = append(articles, article)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(articles, func(i, j int) bool {
+		return q.Less(articles[i], articles[j])
+	})
+	return articles, nil
+}
+
+// matchingKeys returns the index entries matching the query, which sorts by
+// updated_on, in the order of the query. The read lock must be held.
+func (s *FileArticles) matchingKeys(q models.ArticleQuery) []updatedKey {
+	keys := []updatedKey{}
+	for i := range s.updated {
+		key := s.updated[i]
+		if q.Descending() {
+			key = s.updated[len(s.updated)-1-i]
+		}
+		if q.Match(models.Article{Id: key.Id, UpdatedOn: key.UpdatedOn}) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// insertKey adds the entry to the index. The lock must be held.
+func (s *FileArticles) insertKey(key updatedKey) {
+	i := sort.Search(len(s.updated), func(i int) bool {
+		return !s.updated[i].less(key)
+	})
+	s.updated = append(s.updated, updatedKey{})
+	copy(s.updated[i+1:], s.updated[i:])
+	s.updated[i] = key
+}
+
+// removeKey removes the entry from the index. The lock must be held.
+func (s *FileArticles) removeKey(key updatedKey) {
+	i := sort.Search(len(s.updated), func(i int) bool {
+		return !s.updated[i].less(key)
+	})
+	if i < len(s.updated) && s.updated[i] == key {
+		s.updated = append(s.updated[:i], s.updated[i+1:]...)
+	}
+}
+
+// FileUsers is a UserStore keeping the users in a key/value file, indexed by
+// email. It is safe for concurrent use.
+type FileUsers struct {
+	mu      sync.RWMutex
+	kv      *kv
+	byEmail map[string]bson.ObjectId
+}
+
+func newFileUsers(store *kv) (*FileUsers, error) {
+	s := &FileUsers{kv: store, byEmail: map[string]bson.ObjectId{}}
+	err := store.each(models.CollectionUser, func(key string, value []byte) error {
+		u := storedUser{}
+		if err := json.Unmarshal(value, &u); err != nil {
+			return err
+		}
+		s.byEmail[u.Email] = u.Id
+		return nil
+	})
+	return s, err
+}
+
+// Get implements models.UserStore
+func (s *FileUsers) Get(id bson.ObjectId) (models.User, error) {
+	value, ok := s.kv.get(models.CollectionUser, id.Hex())
+	if !ok {
+		return models.User{}, models.ErrNotFound
+	}
+	u := storedUser{}
+	err := json.Unmarshal(value, &u)
+	return u.user(), err
+}
+
+// GetByEmail implements models.UserStore
+func (s *FileUsers) GetByEmail(email string) (models.User, error) {
+	s.mu.RLock()
+	id, ok := s.byEmail[models.NormalizeEmail(email)]
+	s.mu.RUnlock()
+	if !ok {
+		return models.User{}, models.ErrNotFound
+	}
+	return s.Get(id)
+}
+
+// Create implements models.UserStore
+func (s *FileUsers) Create(user *models.User) error {
+	if err := user.BeforeInsert(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byEmail[user.Email]; ok {
+		return models.ErrEmailTaken
+	}
+	if err := s.put(*user); err != nil {
+		return err
+	}
+	s.byEmail[user.Email] = user.Id
+	return nil
+}
+
+// SetAdmin implements models.UserStore
+func (s *FileUsers) SetAdmin(email string, admin bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.byEmail[models.NormalizeEmail(email)]
+	if !ok {
+		return models.ErrNotFound
+	}
+	user, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	user.Admin = admin
+	return s.put(user)
+}
+
+func (s *FileUsers) put(user models.User) error {
+	value, err := json.Marshal(newStoredUser(user))
+	if err != nil {
+		return err
+	}
+	return s.kv.put(models.CollectionUser, user.Id.Hex(), value)
+}
+
+// FileBackend holds the stores kept in a single key/value file
+type FileBackend struct {
+	Articles *FileArticles
+	Users    *FileUsers
+	kv       *kv
+}
+
+// OpenFile returns the stores kept in the file at path, which is created if
+// it does not exist
+func OpenFile(path string) (*FileBackend, error) {
+	store, err := openKV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &FileBackend{kv: store}
+	if b.Articles, err = newFileArticles(store); err != nil {
+		store.close()
+		return nil, err
+	}
+	if b.Users, err = newFileUsers(store); err != nil {
+		store.close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// Stores implements Backend
+func (b *FileBackend) Stores() (models.ArticleStore, models.UserStore) {
+	return b.Articles, b.Users
+}
+
+// Close implements Backend by closing the file
+func (b *FileBackend) Close() error {
+	return b.kv.close()
+}
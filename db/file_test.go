@@ -0,0 +1,166 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+// fill creates the articles with the titles, a few milliseconds apart, and
+// updates every other one so that the update order differs from the
+// creation order
+func fill(t *testing.T, store models.ArticleStore, titles ...string) []models.Article {
+	articles := make([]models.Article, len(titles))
+	for i, title := range titles {
+		articles[i] = models.Article{Title: title, Body: "Body of " + title}
+		if err := store.Create(&articles[i]); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	for i := 0; i < len(articles); i += 2 {
+		changed := articles[i]
+		changed.Body += ", updated"
+		if _, err := store.Update(articles[i], &changed); err != nil {
+			t.Fatal(err)
+		}
+		articles[i] = changed
+		time.Sleep(2 * time.Millisecond)
+	}
+	return articles
+}
+
+// titles lists the titles of the articles, in order
+func titles(articles []models.Article) string {
+	names := make([]string, len(articles))
+	for i, article := range articles {
+		names[i] = article.Title
+	}
+	return strings.Join(names, " ")
+}
+
+// walk lists every article of the query, following the cursor of each page
+func walk(t *testing.T, store models.ArticleStore, q models.ArticleQuery) string {
+	var pages []string
+	for {
+		articles, more, err := store.List(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, titles(articles))
+		if !more {
+			return strings.Join(pages, " | ")
+		}
+		q.Cursor = models.NewCursor(articles[len(articles)-1])
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "articles.db")
+	b, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	articles := fill(t, b.Articles, "a", "b", "c", "d")
+	if err := b.Articles.Delete(articles[3].Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Articles.Delete(articles[3].Id); err != models.ErrNotFound {
+		t.Errorf("got error %v deleting twice, want ErrNotFound", err)
+	}
+
+	user := models.User{Name: "Ann", Email: "Ann@Example.com", Password: "secret123"}
+	if err := b.Users.Create(&user); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Users.Create(&models.User{Email: "ann@example.com", Password: "secret123"}); err != models.ErrEmailTaken {
+		t.Errorf("got error %v, want ErrEmailTaken", err)
+	}
+	if err := b.Users.SetAdmin("ann@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	before := walk(t, b.Articles, models.ArticleQuery{Page: 1, Limit: 2, Sort: "-updated_on"})
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	a, err := b.Articles.Get(articles[0].Id)
+	if err != nil || a.Body != "Body of a, updated" || a.Version != 2 || !a.UpdatedOn.Equal(articles[0].UpdatedOn) {
+		t.Errorf("got %+v and error %v, want the updated article", a, err)
+	}
+	if _, err := b.Articles.Get(articles[3].Id); err != models.ErrNotFound {
+		t.Errorf("got error %v, want the deleted article gone", err)
+	}
+	if count, _ := b.Articles.Count(models.NewArticleQuery()); count != 3 {
+		t.Errorf("got %d articles, want 3", count)
+	}
+	if after := walk(t, b.Articles, models.ArticleQuery{Page: 1, Limit: 2, Sort: "-updated_on"}); after != before {
+		t.Errorf("got pages %q after reopening, want %q", after, before)
+	}
+
+	u, err := b.Users.GetByEmail("ANN@example.com")
+	if err != nil || !u.Admin || !u.CheckPassword("secret123") {
+		t.Errorf("got %+v and error %v, want the admin with the password", u, err)
+	}
+}
+
+func TestFileList(t *testing.T) {
+	b, err := OpenFile(filepath.Join(t.TempDir(), "articles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	articles := fill(t, b.Articles, "e", "a", "d", "b", "c")
+	memory := NewMemoryArticles()
+	for _, article := range articles {
+		memory.articles[article.Id] = article
+	}
+
+	tests := []struct {
+		name string
+		q    models.ArticleQuery
+	}{
+		{"default", models.NewArticleQuery()},
+		{"ascending", models.ArticleQuery{Page: 1, Limit: 20, Sort: "updated_on"}},
+		{"created", models.ArticleQuery{Page: 1, Limit: 20, Sort: "-created_on"}},
+		{"title", models.ArticleQuery{Page: 1, Limit: 20, Sort: "title"}},
+		{"second page", models.ArticleQuery{Page: 2, Limit: 2, Sort: "-updated_on"}},
+		{"past the end", models.ArticleQuery{Page: 9, Limit: 2, Sort: "-updated_on"}},
+		{"from", models.ArticleQuery{Page: 1, Limit: 20, Sort: "-updated_on", From: articles[1].UpdatedOn}},
+		{"to", models.ArticleQuery{Page: 1, Limit: 20, Sort: "-updated_on", To: articles[0].UpdatedOn}},
+	}
+	for _, tt := range tests {
+		got, gotMore, err := b.Articles.List(tt.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, wantMore, _ := memory.List(tt.q)
+		if titles(got) != titles(want) || gotMore != wantMore {
+			t.Errorf("%s: got %q and more %v, want %q and %v", tt.name, titles(got), gotMore, titles(want), wantMore)
+		}
+
+		gotCount, _ := b.Articles.Count(tt.q)
+		wantCount, _ := memory.Count(tt.q)
+		if gotCount != wantCount {
+			t.Errorf("%s: got count %d, want %d", tt.name, gotCount, wantCount)
+		}
+	}
+
+	for _, sort := range []string{"-updated_on", "updated_on"} {
+		q := models.ArticleQuery{Page: 1, Limit: 2, Sort: sort}
+		if got, want := walk(t, b.Articles, q), walk(t, memory, q); got != want {
+			t.Errorf("%s: got pages %q, want %q", sort, got, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+const (
+	// IndexOk is the state of registered indexes present in the database
+	IndexOk = "ok"
+	// IndexMissing is the state of registered indexes absent from the database
+	IndexMissing = "missing"
+	// IndexExtra is the state of indexes present in the database that no
+	// model registered
+	IndexExtra = "extra"
+)
+
+// IndexStatus describes the state of an index of a collection
+type IndexStatus struct {
+	Collection string
+	Name       string
+	Key        []string
+	State      string
+}
+
+// String formats the status as one line of the index report
+func (s IndexStatus) String() string {
+	return fmt.Sprintf("%-8s %s.%s (%s)", s.State, s.Collection, s.Name, strings.Join(s.Key, ", "))
+}
+
+// EnsureIndexes creates the indexes registered by the models
+func EnsureIndexes(database *mgo.Database) error {
+	for _, index := range models.Indexes() {
+		err := database.C(index.Collection).EnsureIndex(index.Index)
+		if err != nil {
+			return fmt.Errorf("ensuring index %s of %s: %v", index.IndexName(), index.Collection, err)
+		}
+	}
+	return nil
+}
+
+// IndexReport compares the indexes registered by the models with the indexes
+// of their collections in the database
+func IndexReport(database *mgo.Database) ([]IndexStatus, error) {
+	report := []IndexStatus{}
+	registered := map[string]map[string]bool{}
+
+	for _, index := range models.Indexes() {
+		if registered[index.Collection] == nil {
+			registered[index.Collection] = map[string]bool{}
+		}
+		registered[index.Collection][index.IndexName()] = true
+	}
+
+	for collection, names := range registered {
+		existing, err := database.C(collection).Indexes()
+		if err != nil && !isNamespaceNotFound(err) {
+			return nil, err
+		}
+
+		found := map[string]bool{}
+		for _, index := range existing {
+			found[index.Name] = true
+			if names[index.Name] || index.Name == "_id_" {
+				continue
+			}
+			report = append(report, IndexStatus{collection, index.Name, index.Key, IndexExtra})
+		}
+
+		for _, index := range models.Indexes() {
+			name := index.IndexName()
+			if index.Collection != collection {
+				continue
+			}
+			state := IndexOk
+			if !found[name] {
+				state = IndexMissing
+			}
+			report = append(report, IndexStatus{collection, name, index.Key, state})
+		}
+	}
+
+	sort.Sort(byCollectionAndName(report))
+	return report, nil
+}
+
+// isNamespaceNotFound reports whether the error is caused by listing the
+// indexes of a collection that does not exist yet
+func isNamespaceNotFound(err error) bool {
+	if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == 26 {
+		return true
+	}
+	return strings.Contains(err.Error(), "ns does not exist") || strings.Contains(err.Error(), "ns not found")
+}
+
+type byCollectionAndName []IndexStatus
+
+func (s byCollectionAndName) Len() int      { return len(s) }
+func (s byCollectionAndName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCollectionAndName) Less(i, j int) bool {
+	if s[i].Collection != s[j].Collection {
+		return s[i].Collection < s[j].Collection
+	}
+	return s[i].Name < s[j].Name
+}
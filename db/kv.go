@@ -0,0 +1,242 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// kv is a key/value store kept in a single file. Values are JSON documents
+// grouped in buckets. Every change is appended to the file as a record and
+// synced before it is applied, the current values are held in memory. The
+// file is compacted to one record per key when opened, and locked as long
+// as it is open.
+type kv struct {
+	mu      sync.RWMutex
+	path    string
+	file    kvFile
+	size    int64
+	broken  error
+	lock    *os.File
+	buckets map[string]map[string][]byte
+}
+
+// kvFile is the file records are appended to, an *os.File except in tests
+type kvFile interface {
+	io.WriteCloser
+	Sync() error
+	Truncate(size int64) error
+}
+
+// kvRecord is a change in the file. A record without value deletes the key.
+type kvRecord struct {
+	Bucket string          `json:"b"`
+	Key    string          `json:"k"`
+	Value  json.RawMessage `json:"v,omitempty"`
+}
+
+// openKV locks the file at path, reads it, creating it if needed, and
+// compacts it. It fails if another process has the file open.
+func openKV(path string) (*kv, error) {
+	l, err := lock(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &kv{path: path, lock: l, buckets: map[string]map[string][]byte{}}
+
+	if err := s.load(); err != nil {
+		if s.file != nil {
+			s.file.Close()
+		}
+		l.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load replays the file, if it exists, and compacts it
+func (s *kv) load() error {
+	f, err := os.Open(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		err = s.replay(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return s.compact()
+}
+
+// replay applies the records read from r. A truncated last record, left by
+// a crash while appending it, is dropped.
+func (s *kv) replay(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		record := kvRecord{}
+		err := dec.Decode(&record)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.apply(record)
+	}
+}
+
+// compact rewrites the file with the current values and reopens it for
+// appending
+func (s *kv) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	for _, bucket := range sortedKeys(s.buckets) {
+		values := s.buckets[bucket]
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := enc.Encode(kvRecord{bucket, key, values[key]}); err != nil {
+				f.Close()
+				return err
+			}
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+// get returns the value of the key in the bucket
+func (s *kv) get(bucket, key string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.buckets[bucket][key]
+	return value, ok
+}
+
+// each calls fn with every key and value of the bucket, in no particular
+// order, until it returns an error
+func (s *kv) each(bucket string, fn func(key string, value []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for key, value := range s.buckets[bucket] {
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// put sets the key in the bucket to the value
+func (s *kv) put(bucket, key string, value []byte) error {
+	return s.write(kvRecord{bucket, key, value})
+}
+
+// delete removes the key from the bucket
+func (s *kv) delete(bucket, key string) error {
+	return s.write(kvRecord{Bucket: bucket, Key: key})
+}
+
+// write appends the record to the file and applies it. A record that fails
+// to be written or synced is truncated off the file, so that it is neither
+// replayed on open nor followed by the next records. If truncating fails too
+// the store refuses every later write.
+func (s *kv) write(record kvRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.broken != nil {
+		return s.broken
+	}
+	_, err = s.file.Write(data)
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		if terr := s.file.Truncate(s.size); terr != nil {
+			s.broken = fmt.Errorf("%s may end with a partial record: %v", s.path, terr)
+		}
+		return err
+	}
+	s.size += int64(len(data))
+	s.apply(record)
+	return nil
+}
+
+func (s *kv) apply(record kvRecord) {
+	values, ok := s.buckets[record.Bucket]
+	if !ok {
+		values = map[string][]byte{}
+		s.buckets[record.Bucket] = values
+	}
+	if record.Value == nil {
+		delete(values, record.Key)
+		return
+	}
+	values[record.Key] = record.Value
+}
+
+// close closes the file and releases its lock
+func (s *kv) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.file.Close()
+	if lerr := s.lock.Close(); err == nil {
+		err = lerr
+	}
+	return err
+}
+
+func sortedKeys(m map[string]map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKVReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.db")
+	s, err := openKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := s.put("letters", key, []byte(`"`+key+`"`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.put("letters", "a", []byte(`"A"`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.delete("letters", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = openKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	if value, _ := s.get("letters", "a"); string(value) != `"A"` {
+		t.Errorf("got a = %s, want the update", value)
+	}
+	if _, ok := s.get("letters", "b"); ok {
+		t.Error("got b, want it deleted")
+	}
+
+	// Compacting leaves one record per key
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 2 {
+		t.Errorf("got %d records after compacting, want 2\n%s", lines, data)
+	}
+}
+
+func TestKVTruncatedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.db")
+	s, err := openKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.put("letters", "a", []byte(`"a"`)); err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+
+	// A crash while appending leaves half a record
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"b":"letters","k":"b","v":"`)
+	f.Close()
+
+	s, err = openKV(path)
+	if err != nil {
+		t.Fatalf("got error %v, want the truncated record dropped", err)
+	}
+	if value, _ := s.get("letters", "a"); string(value) != `"a"` {
+		t.Errorf("got a = %s, want the records before the truncated one", value)
+	}
+	if _, ok := s.get("letters", "b"); ok {
+		t.Error("got b from the truncated record")
+	}
+	if err := s.put("letters", "c", []byte(`"c"`)); err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+
+	s, err = openKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if value, _ := s.get("letters", "c"); string(value) != `"c"` {
+		t.Errorf("got c = %s, want the record written after the truncated one", value)
+	}
+}
+
+func TestKVCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.db")
+	if err := ioutil.WriteFile(path, []byte("{\"b\":\"letters\",\"k\":\"a\",\"v\":1}\nnope\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Failing to open must release the lock
+	for i := 0; i < 2; i++ {
+		if _, err := openKV(path); err == nil || strings.Contains(err.Error(), "in use") {
+			t.Errorf("open %d: got error %v, want the corrupt record", i, err)
+		}
+	}
+}
+
+// failingFile fails to write half of the records or to sync them, like a
+// full disk, and optionally to truncate
+type failingFile struct {
+	*os.File
+	partial  bool
+	truncate bool
+}
+
+func (f failingFile) Write(p []byte) (int, error) {
+	if f.partial {
+		n, _ := f.File.Write(p[:len(p)/2])
+		return n, errors.New("disk full")
+	}
+	return f.File.Write(p)
+}
+
+func (f failingFile) Sync() error {
+	return errors.New("sync failed")
+}
+
+func (f failingFile) Truncate(size int64) error {
+	if f.truncate {
+		return errors.New("truncate failed")
+	}
+	return f.File.Truncate(size)
+}
+
+func TestKVFailedWrite(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "kv.db")
+		s, err := openKV(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.put("letters", "a", []byte(`"a"`)); err != nil {
+			t.Fatal(err)
+		}
+
+		file := s.file
+		s.file = failingFile{File: file.(*os.File), partial: partial}
+		if err := s.put("letters", "b", []byte(`"b"`)); err == nil {
+			t.Errorf("partial %v: got no error writing b", partial)
+		}
+		if _, ok := s.get("letters", "b"); ok {
+			t.Errorf("partial %v: got b applied after failing to write it", partial)
+		}
+
+		s.file = file
+		if err := s.put("letters", "c", []byte(`"c"`)); err != nil {
+			t.Fatal(err)
+		}
+		s.close()
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "{\"b\":\"letters\",\"k\":\"a\",\"v\":\"a\"}\n{\"b\":\"letters\",\"k\":\"c\",\"v\":\"c\"}\n"; string(data) != want {
+			t.Errorf("partial %v: got file\n%s\nwant the failed record truncated off\n%s", partial, data, want)
+		}
+	}
+
+	s, err := openKV(filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	file := s.file
+	s.file = failingFile{File: file.(*os.File), partial: true, truncate: true}
+	s.put("letters", "a", []byte(`"a"`))
+	s.file = file
+	if err := s.put("letters", "b", []byte(`"b"`)); err == nil || !strings.Contains(err.Error(), "partial record") {
+		t.Errorf("got error %v, want writes refused after failing to truncate", err)
+	}
+}
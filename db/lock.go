@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package db
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lock takes an exclusive lock of path + ".lock", so that a second process,
+// e.g. the admin command next to a running server, can't open the same file
+// and overwrite its changes. Closing the returned file releases the lock.
+func lock(path string) (*os.File, error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, fmt.Errorf("%s is in use by another process, stop the server first", path)
+		}
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		open func(path string) (Backend, error)
+	}{
+		{"file", func(path string) (Backend, error) { return OpenFile(path) }},
+		{"memory", func(path string) (Backend, error) { return OpenMemory(path) }},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		b, err := tt.open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tt.open(path); err == nil || !strings.Contains(err.Error(), "in use") {
+			t.Errorf("%s: got error %v opening the file twice, want it in use", tt.name, err)
+		}
+
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		b, err = tt.open(path)
+		if err != nil {
+			t.Errorf("%s: got error %v after closing, want the file released", tt.name, err)
+			continue
+		}
+		b.Close()
+	}
+}
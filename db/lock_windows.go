@@ -0,0 +1,9 @@
+package db
+
+import "os"
+
+// lock creates path + ".lock" without locking it: there is no flock on
+// Windows, so nothing keeps two processes from opening the same file
+func lock(path string) (*os.File, error) {
+	return os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+}
@@ -0,0 +1,426 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+// MemoryArticles is an ArticleStore keeping the articles in memory. It lists
+// and pages articles like MongoArticles and is safe for concurrent use.
+type MemoryArticles struct {
+	mu       sync.RWMutex
+	articles map[bson.ObjectId]models.Article
+}
+
+// NewMemoryArticles returns an empty in-memory article store
+func NewMemoryArticles() *MemoryArticles {
+	return &MemoryArticles{articles: map[bson.ObjectId]models.Article{}}
+}
+
+// Get implements models.ArticleStore
+func (s *MemoryArticles) Get(id bson.ObjectId) (models.Article, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	article, ok := s.articles[id]
+	if !ok {
+		return models.Article{}, models.ErrNotFound
+	}
+	return article, nil
+}
+
+// List implements models.ArticleStore
+func (s *MemoryArticles) List(q models.ArticleQuery) ([]models.Article, bool, error) {
+	articles, more := page(s.matching(q), q)
+	return articles, more, nil
+}
+
+// Count implements models.ArticleStore
+func (s *MemoryArticles) Count(q models.ArticleQuery) (int, error) {
+	q.Cursor = nil
+	return len(s.matching(q)), nil
+}
+
+// Search implements models.ArticleStore
+func (s *MemoryArticles) Search(text string, q models.ArticleQuery) ([]models.SearchResult, int, error) {
+	s.mu.RLock()
+	articles := make([]models.Article, 0, len(s.articles))
+	for _, article := range s.articles {
+		articles = append(articles, article)
+	}
+	s.mu.RUnlock()
+
+	results, total := search(articles, text, q)
+	return results, total, nil
+}
+
+// Create implements models.ArticleStore
+func (s *MemoryArticles) Create(article *models.Article) error {
+	article.BeforeInsert()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.articles[article.Id]; ok {
+		return models.ErrConflict
+	}
+	s.articles[article.Id] = *article
+	return nil
+}
+
+// Update implements models.ArticleStore
+func (s *MemoryArticles) Update(stored models.Article, article *models.Article) (*models.Article, error) {
+	doc, err := article.ChangesFrom(stored)
+	if err == models.ErrConflict {
+		return &stored, err
+	}
+	if err != nil || doc == nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.articles[stored.Id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	if current.Version != stored.Version {
+		return &current, models.ErrConflict
+	}
+	s.articles[stored.Id] = *article
+	return nil, nil
+}
+
+// Delete implements models.ArticleStore
+func (s *MemoryArticles) Delete(id bson.ObjectId) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.articles[id]; !ok {
+		return models.ErrNotFound
+	}
+	delete(s.articles, id)
+	return nil
+}
+
+// matching returns the articles matching the query in the order of the query
+func (s *MemoryArticles) matching(q models.ArticleQuery) []models.Article {
+	s.mu.RLock()
+	articles := []models.Article{}
+	for _, article := range s.articles {
+		if q.Match(article) {
+			articles = append(articles, article)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(articles, func(i, j int) bool {
+		return q.Less(articles[i], articles[j])
+	})
+	return articles
+}
+
+// MemoryUsers is a UserStore keeping the users in memory. It is safe for
+// concurrent use.
+type MemoryUsers struct {
+	mu    sync.RWMutex
+	users map[bson.ObjectId]models.User
+}
+
+// NewMemoryUsers returns an empty in-memory user store
+func NewMemoryUsers() *MemoryUsers {
+	return &MemoryUsers{users: map[bson.ObjectId]models.User{}}
+}
+
+// Get implements models.UserStore
+func (s *MemoryUsers) Get(id bson.ObjectId) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return models.User{}, models.ErrNotFound
+	}
+	return user, nil
+}
+
+// GetByEmail implements models.UserStore
+func (s *MemoryUsers) GetByEmail(email string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	email = models.NormalizeEmail(email)
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, models.ErrNotFound
+}
+
+// Create implements models.UserStore
+func (s *MemoryUsers) Create(user *models.User) error {
+	if err := user.BeforeInsert(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Email == user.Email {
+			return models.ErrEmailTaken
+		}
+	}
+	s.users[user.Id] = *user
+	return nil
+}
+
+// SetAdmin implements models.UserStore
+func (s *MemoryUsers) SetAdmin(email string, admin bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email = models.NormalizeEmail(email)
+	for id, user := range s.users {
+		if user.Email == email {
+			user.Admin = admin
+			s.users[id] = user
+			return nil
+		}
+	}
+	return models.ErrNotFound
+}
+
+// page returns the page of the query of the sorted articles and whether more
+// articles follow it
+func page(articles []models.Article, q models.ArticleQuery) ([]models.Article, bool) {
+	start := q.Skip()
+	if start < 0 || start > len(articles) {
+		start = len(articles)
+	}
+	articles = articles[start:]
+
+	more := len(articles) > q.Limit
+	if more {
+		articles = articles[:q.Limit]
+	}
+	return articles, more
+}
+
+// search returns the page of the query of the articles matching the text,
+// most relevant first, and the total number of matches. Articles match if
+// they contain any of the words of the text, words prefixed with `-` exclude
+// articles. Like the text index, a word in the title weighs three times a
+// word in the body.
+func search(articles []models.Article, text string, q models.ArticleQuery) ([]models.SearchResult, int) {
+	include, exclude := []string{}, []string{}
+	for _, term := range strings.Fields(strings.ToLower(text)) {
+		if strings.HasPrefix(term, "-") {
+			exclude = append(exclude, words(term)...)
+		} else {
+			include = append(include, words(term)...)
+		}
+	}
+
+	results := []models.SearchResult{}
+	for _, article := range articles {
+		title, body := countWords(article.Title), countWords(article.Body)
+		score := 0.0
+		for _, word := range include {
+			score += 3*title[word] + body[word]
+		}
+		for _, word := range exclude {
+			if title[word]+body[word] > 0 {
+				score = 0
+			}
+		}
+		if score > 0 {
+			results = append(results, models.SearchResult{Article: article, Score: score})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Id > results[j].Id
+	})
+
+	total := len(results)
+	start := q.Skip()
+	if start < 0 || start > total {
+		start = total
+	}
+	results = results[start:]
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, total
+}
+
+// words splits the lower cased text into words
+func words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// countWords returns how often each word occurs in the text
+func countWords(text string) map[string]float64 {
+	counts := map[string]float64{}
+	for _, word := range words(strings.ToLower(text)) {
+		counts[word]++
+	}
+	return counts
+}
+
+// MemoryBackend holds the in-memory stores. With a file, the stores are
+// loaded from it on open and written back to it by Save, and the file is
+// locked until Close so that no other process overwrites it.
+type MemoryBackend struct {
+	Articles *MemoryArticles
+	Users    *MemoryUsers
+	File     string
+	lock     *os.File
+}
+
+// memorySnapshot is the content of the file of a MemoryBackend
+type memorySnapshot struct {
+	Articles []models.Article `json:"articles"`
+	Users    []storedUser     `json:"users"`
+}
+
+// storedUser is a user along with its password hash, which is not part of
+// the JSON representation of users. The memory and file backends store users
+// as storedUser.
+type storedUser struct {
+	models.User
+	PasswordHash []byte `json:"password_hash"`
+}
+
+func newStoredUser(user models.User) storedUser {
+	return storedUser{User: user, PasswordHash: user.PasswordHash}
+}
+
+func (u storedUser) user() models.User {
+	user := u.User
+	user.PasswordHash = u.PasswordHash
+	return user
+}
+
+// OpenMemory returns the in-memory stores, loaded from the file if it is set
+// and exists. It fails if another process has the file open.
+func OpenMemory(file string) (*MemoryBackend, error) {
+	b := &MemoryBackend{
+		Articles: NewMemoryArticles(),
+		Users:    NewMemoryUsers(),
+		File:     file,
+	}
+	if len(file) == 0 {
+		return b, nil
+	}
+
+	l, err := lock(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.load(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	b.lock = l
+	return b, nil
+}
+
+// load reads the stores from the file, if it exists
+func (b *MemoryBackend) load() error {
+	data, err := ioutil.ReadFile(b.File)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	snapshot := memorySnapshot{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("can't read %s: %v", b.File, err)
+	}
+	for _, article := range snapshot.Articles {
+		b.Articles.articles[article.Id] = article
+	}
+	for _, u := range snapshot.Users {
+		b.Users.users[u.Id] = u.user()
+	}
+	return nil
+}
+
+// Stores implements Backend
+func (b *MemoryBackend) Stores() (models.ArticleStore, models.UserStore) {
+	return b.Articles, b.Users
+}
+
+// Close implements Backend by saving the stores and releasing the file
+func (b *MemoryBackend) Close() error {
+	err := b.Save()
+	if b.lock != nil {
+		if lerr := b.lock.Close(); err == nil {
+			err = lerr
+		}
+		b.lock = nil
+	}
+	return err
+}
+
+// Save writes the stores to the file, if it is set. The file is replaced
+// atomically so that it is never left half written.
+func (b *MemoryBackend) Save() error {
+	if len(b.File) == 0 {
+		return nil
+	}
+
+	snapshot := memorySnapshot{
+		Articles: []models.Article{},
+		Users:    []storedUser{},
+	}
+	b.Articles.mu.RLock()
+	for _, article := range b.Articles.articles {
+		snapshot.Articles = append(snapshot.Articles, article)
+	}
+	b.Articles.mu.RUnlock()
+	b.Users.mu.RLock()
+	for _, user := range b.Users.users {
+		snapshot.Users = append(snapshot.Users, newStoredUser(user))
+	}
+	b.Users.mu.RUnlock()
+
+	// Keep the file stable between saves
+	sort.Slice(snapshot.Articles, func(i, j int) bool {
+		return snapshot.Articles[i].Id < snapshot.Articles[j].Id
+	})
+	sort.Slice(snapshot.Users, func(i, j int) bool {
+		return snapshot.Users[i].Id < snapshot.Users[j].Id
+	})
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := b.File + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.File)
+}
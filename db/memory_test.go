@@ -0,0 +1,106 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+func TestMemorySnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "articles.json")
+	b, err := OpenMemory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	articles := fill(t, b.Articles, "a", "b", "c")
+	if err := b.Articles.Delete(articles[1].Id); err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Name: "Ann", Email: "ann@example.com", Password: "secret123"}
+	if err := b.Users.Create(&user); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Users.SetAdmin(user.Email, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = OpenMemory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	a, err := b.Articles.Get(articles[0].Id)
+	if err != nil || a.Body != "Body of a, updated" || a.Version != 2 || !a.UpdatedOn.Equal(articles[0].UpdatedOn) {
+		t.Errorf("got %+v and error %v, want the updated article", a, err)
+	}
+	if _, err := b.Articles.Get(articles[1].Id); err != models.ErrNotFound {
+		t.Errorf("got error %v, want the deleted article gone", err)
+	}
+	if got := walk(t, b.Articles, models.NewArticleQuery()); got != "c a" {
+		t.Errorf("got %q, want c a", got)
+	}
+
+	u, err := b.Users.GetByEmail("ann@example.com")
+	if err != nil || !u.Admin || !u.CheckPassword("secret123") {
+		t.Errorf("got %+v and error %v, want the admin with the password", u, err)
+	}
+}
+
+func TestMemoryList(t *testing.T) {
+	store := NewMemoryArticles()
+
+	// Updated in the order a b e d c
+	articles := fill(t, store, "e", "a", "d", "b", "c")
+
+	tests := []struct {
+		name string
+		q    models.ArticleQuery
+		want string
+		more bool
+	}{
+		{"default", models.NewArticleQuery(), "c d e b a", false},
+		{"ascending", models.ArticleQuery{Page: 1, Limit: 20, Sort: "updated_on"}, "a b e d c", false},
+		{"created", models.ArticleQuery{Page: 1, Limit: 20, Sort: "-created_on"}, "c b d a e", false},
+		{"title", models.ArticleQuery{Page: 1, Limit: 20, Sort: "title"}, "a b c d e", false},
+		{"first page", models.ArticleQuery{Page: 1, Limit: 2, Sort: "-updated_on"}, "c d", true},
+		{"last page", models.ArticleQuery{Page: 3, Limit: 2, Sort: "-updated_on"}, "a", false},
+		{"past the end", models.ArticleQuery{Page: 9, Limit: 2, Sort: "-updated_on"}, "", false},
+		{"overflowing page", models.ArticleQuery{Page: 922337203685477580, Limit: 100, Sort: "-updated_on"}, "", false},
+		{"from", models.ArticleQuery{Page: 1, Limit: 20, Sort: "-updated_on", From: articles[3].UpdatedOn}, "c d e b", false},
+		{"to", models.ArticleQuery{Page: 1, Limit: 20, Sort: "-updated_on", To: articles[0].UpdatedOn}, "b a", false},
+		{"cursor", models.ArticleQuery{Page: 1, Limit: 2, Sort: "-updated_on", Cursor: models.NewCursor(articles[0])}, "b a", false},
+	}
+	for _, tt := range tests {
+		got, more, err := store.List(tt.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if titles(got) != tt.want || more != tt.more {
+			t.Errorf("%s: got %q and more %v, want %q and %v", tt.name, titles(got), more, tt.want, tt.more)
+		}
+	}
+
+	if count, _ := store.Count(models.ArticleQuery{Sort: "-updated_on", Cursor: models.NewCursor(articles[0])}); count != 5 {
+		t.Errorf("got count %d, want the cursor ignored", count)
+	}
+
+	pages := []struct {
+		sort string
+		want string
+	}{
+		{"-updated_on", "c d | e b | a"},
+		{"updated_on", "a b | e d | c"},
+	}
+	for _, tt := range pages {
+		q := models.ArticleQuery{Page: 1, Limit: 2, Sort: tt.sort}
+		if got := walk(t, store, q); got != tt.want {
+			t.Errorf("%s: got pages %q, want %q", tt.sort, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+// MongoArticles is the ArticleStore backed by the articles collection
+type MongoArticles struct {
+	C *mgo.Collection
+}
+
+// NewMongoArticles returns the article store of the database
+func NewMongoArticles(database *mgo.Database) *MongoArticles {
+	return &MongoArticles{C: database.C(models.CollectionArticle)}
+}
+
+// Get implements models.ArticleStore
+func (s *MongoArticles) Get(id bson.ObjectId) (models.Article, error) {
+	article := models.Article{}
+	err := s.C.FindId(id).One(&article)
+	return article, err
+}
+
+// List implements models.ArticleStore
+func (s *MongoArticles) List(q models.ArticleQuery) ([]models.Article, bool, error) {
+	// Fetch one more article than requested to know if there is a next page
+	articles := []models.Article{}
+	err := s.C.
+		Find(q.Selector()).
+		Sort(q.SortFields()...).
+		Skip(q.Skip()).
+		Limit(q.Limit + 1).
+		All(&articles)
+	if err != nil {
+		return nil, false, err
+	}
+
+	more := len(articles) > q.Limit
+	if more {
+		articles = articles[:q.Limit]
+	}
+	return articles, more, nil
+}
+
+// Count implements models.ArticleStore
+func (s *MongoArticles) Count(q models.ArticleQuery) (int, error) {
+	q.Cursor = nil
+	return s.C.Find(q.Selector()).Count()
+}
+
+// Search implements models.ArticleStore using the text index of the
+// collection
+func (s *MongoArticles) Search(text string, q models.ArticleQuery) ([]models.SearchResult, int, error) {
+	selector := bson.M{"$text": bson.M{"$search": text}}
+	results := []models.SearchResult{}
+	err := s.C.
+		Find(selector).
+		Select(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		Sort("$textScore:score").
+		Skip(q.Skip()).
+		Limit(q.Limit).
+		All(&results)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.C.Find(selector).Count()
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+// Create implements models.ArticleStore
+func (s *MongoArticles) Create(article *models.Article) error {
+	article.BeforeInsert()
+	err := s.C.Insert(article)
+	if mgo.IsDup(err) {
+		return models.ErrConflict
+	}
+	return err
+}
+
+// Update implements models.ArticleStore
+func (s *MongoArticles) Update(stored models.Article, article *models.Article) (*models.Article, error) {
+	doc, err := article.ChangesFrom(stored)
+	if err == models.ErrConflict {
+		return &stored, err
+	}
+	if err != nil || doc == nil {
+		return nil, err
+	}
+
+	err = s.C.Update(stored.VersionSelector(), doc)
+	if err != mgo.ErrNotFound {
+		return nil, err
+	}
+
+	current, err := s.Get(stored.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &current, models.ErrConflict
+}
+
+// Delete implements models.ArticleStore
+func (s *MongoArticles) Delete(id bson.ObjectId) error {
+	return s.C.RemoveId(id)
+}
+
+// MongoUsers is the UserStore backed by the users collection
+type MongoUsers struct {
+	C *mgo.Collection
+}
+
+// NewMongoUsers returns the user store of the database
+func NewMongoUsers(database *mgo.Database) *MongoUsers {
+	return &MongoUsers{C: database.C(models.CollectionUser)}
+}
+
+// Get implements models.UserStore
+func (s *MongoUsers) Get(id bson.ObjectId) (models.User, error) {
+	user := models.User{}
+	err := s.C.FindId(id).One(&user)
+	return user, err
+}
+
+// GetByEmail implements models.UserStore
+func (s *MongoUsers) GetByEmail(email string) (models.User, error) {
+	user := models.User{}
+	err := s.C.Find(bson.M{"email": models.NormalizeEmail(email)}).One(&user)
+	return user, err
+}
+
+// Create implements models.UserStore
+func (s *MongoUsers) Create(user *models.User) error {
+	if err := user.BeforeInsert(); err != nil {
+		return err
+	}
+	err := s.C.Insert(user)
+	if mgo.IsDup(err) {
+		return models.ErrEmailTaken
+	}
+	return err
+}
+
+// SetAdmin implements models.UserStore
+func (s *MongoUsers) SetAdmin(email string, admin bool) error {
+	query := bson.M{"email": models.NormalizeEmail(email)}
+	return s.C.Update(query, bson.M{"$set": bson.M{"admin": admin}})
+}
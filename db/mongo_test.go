@@ -0,0 +1,133 @@
+package db
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+// mongoTestUrl is the database the mongo tests run against unless
+// MONGODB_TEST_URL is set. The tests drop it.
+const mongoTestUrl = "mongodb://localhost:27017/articles_demo_test"
+
+// mongoArticles returns the article store of an empty test database, or
+// skips the test if mongo can't be reached
+func mongoArticles(t *testing.T) *MongoArticles {
+	url := os.Getenv("MONGODB_TEST_URL")
+	if len(url) == 0 {
+		url = mongoTestUrl
+	}
+	session, err := mgo.DialWithTimeout(url, time.Second)
+	if err != nil {
+		t.Skipf("mongo is not available at %s: %v", url, err)
+	}
+	database := session.DB("")
+	t.Cleanup(func() {
+		database.DropDatabase()
+		session.Close()
+	})
+
+	if err := database.DropDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureIndexes(database); err != nil {
+		t.Fatal(err)
+	}
+	return NewMongoArticles(database)
+}
+
+func TestMongoUpdate(t *testing.T) {
+	store := mongoArticles(t)
+
+	stored := models.Article{Title: "a", Body: "Body of a"}
+	if err := store.Create(&stored); err != nil {
+		t.Fatal(err)
+	}
+	changed := stored
+	changed.Title = "b"
+	if _, err := store.Update(stored, &changed); err != nil {
+		t.Fatal(err)
+	}
+
+	// The version selector no longer matches the stale article
+	stale := stored
+	stale.Body = "Stale body"
+	current, err := store.Update(stored, &stale)
+	if err != models.ErrConflict || current == nil || current.Title != "b" || current.Version != 2 {
+		t.Errorf("got %+v and error %v, want the current article and ErrConflict", current, err)
+	}
+
+	a, err := store.Get(stored.Id)
+	if err != nil || a.Title != "b" || a.Body != "Body of a" || a.Version != 2 {
+		t.Errorf("got %+v and error %v, want the first update only", a, err)
+	}
+}
+
+func TestMongoList(t *testing.T) {
+	store := mongoArticles(t)
+
+	articles := fill(t, store, "e", "a", "d", "b", "c")
+	memory := NewMemoryArticles()
+	for _, article := range articles {
+		memory.articles[article.Id] = article
+	}
+
+	tests := []struct {
+		name string
+		q    models.ArticleQuery
+	}{
+		{"default", models.NewArticleQuery()},
+		{"ascending", models.ArticleQuery{Page: 1, Limit: 20, Sort: "updated_on"}},
+		{"title", models.ArticleQuery{Page: 1, Limit: 20, Sort: "title"}},
+		{"second page", models.ArticleQuery{Page: 2, Limit: 2, Sort: "-updated_on"}},
+		{"cursor", models.ArticleQuery{Page: 1, Limit: 2, Sort: "-updated_on", Cursor: models.NewCursor(articles[0])}},
+		{"ascending cursor", models.ArticleQuery{Page: 1, Limit: 2, Sort: "updated_on", Cursor: models.NewCursor(articles[1])}},
+	}
+	for _, tt := range tests {
+		got, gotMore, err := store.List(tt.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, wantMore, _ := memory.List(tt.q)
+		if titles(got) != titles(want) || gotMore != wantMore {
+			t.Errorf("%s: got %q and more %v, want %q and %v", tt.name, titles(got), gotMore, titles(want), wantMore)
+		}
+	}
+
+	for _, sort := range []string{"-updated_on", "updated_on"} {
+		q := models.ArticleQuery{Page: 1, Limit: 2, Sort: sort}
+		if got, want := walk(t, store, q), walk(t, memory, q); got != want {
+			t.Errorf("%s: got pages %q, want %q", sort, got, want)
+		}
+	}
+}
+
+func TestMongoSearch(t *testing.T) {
+	store := mongoArticles(t)
+	fill(t, store, "apple pie", "banana", "apple")
+
+	results, total, err := store.Search("apple", models.ArticleQuery{Page: 1, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || total != 2 || results[0].Score <= 0 {
+		t.Errorf("got %+v of %d, want one scored result of 2", results, total)
+	}
+
+	results, _, err = store.Search("apple", models.ArticleQuery{Page: 2, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("got %+v, want the second result", results)
+	}
+
+	results, total, err = store.Search("cherry", models.NewArticleQuery())
+	if err != nil || len(results) != 0 || total != 0 {
+		t.Errorf("got %+v of %d and error %v, want no results", results, total, err)
+	}
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	// Strong consistency reads from and writes to the primary, the default
+	Strong = "strong"
+	// Monotonic consistency reads from a secondary until the first write
+	Monotonic = "monotonic"
+	// Eventual consistency reads from any secondary
+	Eventual = "eventual"
+)
+
+// SessionOptions tune mongo sessions. Zero values keep the settings of the
+// session they are applied to, which start as strong consistency and
+// acknowledged writes.
+type SessionOptions struct {
+	// Mode is the consistency mode: Strong, Monotonic or Eventual
+	Mode string
+
+	// Safe is the write concern, e.g. &mgo.Safe{WMode: "majority", J: true}
+	Safe *mgo.Safe
+
+	// PoolLimit is the maximum number of sockets per server
+	PoolLimit int
+
+	// SocketTimeout is how long to wait for a server to respond
+	SocketTimeout time.Duration
+}
+
+// checkMode returns an error for unknown consistency modes
+func checkMode(name string) error {
+	switch name {
+	case Strong, Monotonic, Eventual:
+		return nil
+	}
+	return fmt.Errorf("unknown consistency mode %q, want %s, %s or %s", name, Strong, Monotonic, Eventual)
+}
+
+// Validate reports invalid options
+func (o SessionOptions) Validate() error {
+	if len(o.Mode) > 0 {
+		if err := checkMode(o.Mode); err != nil {
+			return err
+		}
+	}
+	if o.Safe != nil && (o.Safe.W < 0 || o.Safe.WTimeout < 0) {
+		return errors.New("write concern w and wtimeout must not be negative")
+	}
+	if o.PoolLimit < 0 || o.SocketTimeout < 0 {
+		return errors.New("pool limit and socket timeout must not be negative")
+	}
+	return nil
+}
+
+// apply sets the options that are not zero on the session
+func (o SessionOptions) apply(s *mgo.Session) {
+	// Refresh so that a socket reserved in another mode is not reused
+	switch o.Mode {
+	case Strong:
+		s.SetMode(mgo.Strong, true)
+	case Monotonic:
+		s.SetMode(mgo.Monotonic, true)
+	case Eventual:
+		s.SetMode(mgo.Eventual, true)
+	}
+	if o.Safe != nil {
+		s.SetSafe(o.Safe)
+	}
+	if o.PoolLimit > 0 {
+		s.SetPoolLimit(o.PoolLimit)
+	}
+	if o.SocketTimeout > 0 {
+		s.SetSocketTimeout(o.SocketTimeout)
+	}
+}
+
+// CloneWith returns a copy of the mongo session with the options applied on
+// top of those given to Connect, e.g. to read from secondaries on some
+// routes. It returns ErrUnavailable while mongo has not been reached.
+func CloneWith(options SessionOptions) (*mgo.Session, error) {
+	s, err := Clone()
+	if err != nil {
+		return nil, err
+	}
+	options.apply(s)
+	return s, nil
+}
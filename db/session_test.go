@@ -0,0 +1,27 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+func TestSessionOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options SessionOptions
+		valid   bool
+	}{
+		{"zero", SessionOptions{}, true},
+		{"all", SessionOptions{Mode: Monotonic, Safe: &mgo.Safe{WMode: "majority", WTimeout: 500, J: true}, PoolLimit: 64, SocketTimeout: time.Minute}, true},
+		{"mode", SessionOptions{Mode: "secondary"}, false},
+		{"w", SessionOptions{Safe: &mgo.Safe{W: -1}}, false},
+		{"pool limit", SessionOptions{PoolLimit: -1}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.options.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
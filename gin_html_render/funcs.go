@@ -0,0 +1,261 @@
+package GinHTMLRender
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DateLayout is the layout of `date` when none is given
+	DateLayout = "Jan 2, 2006 15:04"
+)
+
+// funcs returns the built-in helpers merged with r.Funcs, which take
+// precedence
+//
+//	{{ date .article.UpdatedOn }}             // Jan 2, 2006 15:04
+//	{{ date .article.UpdatedOn "2006-01-02" }} // 2006-01-02
+//	{{ ago .article.UpdatedOn }}              // 3 hours ago
+//	{{ .article.Body | truncate 140 }}        // first 140 characters…
+//	{{ pluralize .total "result" "results" }} // 1 result, 2 results
+//	{{ markdown .article.Body }}              // <p>…</p>
+//	{{ urlFor "article" .article.Id.Hex }}    // /articles/5e…
+//	<script>var article = {{ json .article }}</script>
+func (r *Render) funcs() template.FuncMap {
+	funcs := template.FuncMap{
+		"date":      date,
+		"ago":       ago,
+		"truncate":  truncate,
+		"pluralize": pluralize,
+		"markdown":  markdown,
+		"urlFor":    r.URLFor,
+		"json":      toJSON,
+	}
+	for name, fn := range r.Funcs {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// URLFor returns the path of the route registered in r.Routes under the
+// name, with its `:param` and `*param` segments replaced by the params in
+// order
+func (r *Render) URLFor(name string, params ...interface{}) (string, error) {
+	path, ok := r.Routes[name]
+	if !ok {
+		return "", fmt.Errorf("urlFor: unknown route %q", name)
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			continue
+		}
+		if len(params) == 0 {
+			return "", fmt.Errorf("urlFor: missing %s of route %q", segment, name)
+		}
+		value := fmt.Sprint(params[0])
+		if strings.HasPrefix(segment, ":") {
+			value = url.PathEscape(value)
+		}
+		segments[i] = value
+		params = params[1:]
+	}
+	if len(params) > 0 {
+		return "", fmt.Errorf("urlFor: too many params for route %q", name)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// toTime returns the time of a time.Time or of an int64 in milliseconds since
+// the epoch, the way timestamps were stored by earlier versions
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		return *t, nil
+	case int64:
+		return time.Unix(0, t*int64(time.Millisecond)), nil
+	case int:
+		return time.Unix(0, int64(t)*int64(time.Millisecond)), nil
+	}
+	return time.Time{}, fmt.Errorf("can't format %T as a date", v)
+}
+
+// date formats the time with the layout, DateLayout by default
+func date(v interface{}, layout ...string) (string, error) {
+	t, err := toTime(v)
+	if err != nil || t.IsZero() {
+		return "", err
+	}
+	if len(layout) > 0 {
+		return t.Format(layout[0]), nil
+	}
+	return t.Format(DateLayout), nil
+}
+
+// ago returns how long ago the time was, e.g. `3 hours ago`
+func ago(v interface{}) (string, error) {
+	t, err := toTime(v)
+	if err != nil || t.IsZero() {
+		return "", err
+	}
+	return relative(time.Since(t)), nil
+}
+
+// relative describes the elapsed duration in its largest unit
+func relative(d time.Duration) string {
+	if d < 0 {
+		return "just now"
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, unit := range units {
+		if n := int(d / unit.size); n > 0 {
+			return pluralize(n, unit.name, unit.name+"s") + " ago"
+		}
+	}
+	return "just now"
+}
+
+// truncate shortens the text to n characters, ending it with an ellipsis.
+// The text comes last so that it can be piped: `{{ .Body | truncate 140 }}`.
+// A negative n counts as zero.
+func truncate(n int, s string) string {
+	if n < 0 {
+		n = 0
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n])) + "…"
+}
+
+// pluralize returns the count with the singular or the plural word
+func pluralize(count int, singular, plural string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, singular)
+	}
+	return fmt.Sprintf("%d %s", count, plural)
+}
+
+// toJSON encodes the value for a script, e.g. `var article = {{ json .article }}`
+func toJSON(v interface{}) (template.JS, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.New("json: " + err.Error())
+	}
+	return template.JS(b), nil
+}
+
+var (
+	mdHeading = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdItem    = regexp.MustCompile(`^[-*]\s+(.*)$`)
+	mdStrong  = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	mdEm      = regexp.MustCompile(`\*([^*]+)\*`)
+	mdLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// markdown renders a safe subset of markdown: paragraphs, headings, lists,
+// code blocks, bold, italic, code and links. HTML in the text is escaped and
+// only http, https, mailto and relative links are kept.
+func markdown(s string) template.HTML {
+	var out, paragraph, list []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			out = append(out, "<p>"+strings.Join(paragraph, "\n")+"</p>")
+			paragraph = nil
+		}
+		if len(list) > 0 {
+			out = append(out, "<ul>"+strings.Join(list, "")+"</ul>")
+			list = nil
+		}
+	}
+
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		switch {
+		case strings.HasPrefix(line, "```"):
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(lines[i], "```"); i++ {
+				code = append(code, template.HTMLEscapeString(lines[i]))
+			}
+			out = append(out, "<pre><code>"+strings.Join(code, "\n")+"</code></pre>")
+		case len(strings.TrimSpace(line)) == 0:
+			flush()
+		case mdHeading.MatchString(line):
+			flush()
+			m := mdHeading.FindStringSubmatch(line)
+			level := len(m[1])
+			out = append(out, fmt.Sprintf("<h%d>%s</h%d>", level, inline(m[2]), level))
+		case mdItem.MatchString(line):
+			if len(paragraph) > 0 {
+				flush()
+			}
+			list = append(list, "<li>"+inline(mdItem.FindStringSubmatch(line)[1])+"</li>")
+		default:
+			if len(list) > 0 {
+				flush()
+			}
+			paragraph = append(paragraph, inline(line))
+		}
+	}
+	flush()
+
+	return template.HTML(strings.Join(out, "\n"))
+}
+
+// inline renders the escaped spans of a line, leaving code spans as they are
+func inline(s string) string {
+	parts := strings.Split(s, "`")
+	for i, part := range parts {
+		part = template.HTMLEscapeString(part)
+		if i%2 == 1 && i < len(parts)-1 {
+			parts[i] = "<code>" + part + "</code>"
+			continue
+		}
+		part = mdLink.ReplaceAllStringFunc(part, func(link string) string {
+			m := mdLink.FindStringSubmatch(link)
+			if !safeURL(m[2]) {
+				return m[1]
+			}
+			return `<a href="` + m[2] + `">` + m[1] + `</a>`
+		})
+		part = mdStrong.ReplaceAllString(part, "<strong>$1</strong>")
+		parts[i] = mdEm.ReplaceAllString(part, "<em>$1</em>")
+	}
+	// An unmatched backtick is kept
+	if len(parts)%2 == 0 {
+		return strings.Join(parts[:len(parts)-1], "") + "`" + parts[len(parts)-1]
+	}
+	return strings.Join(parts, "")
+}
+
+// safeURL returns whether the escaped url may be linked to
+func safeURL(u string) bool {
+	for _, prefix := range []string{"http://", "https://", "mailto:", "/", "#"} {
+		if strings.HasPrefix(u, prefix) {
+			return !strings.HasPrefix(u, "//") && !strings.HasPrefix(u, "/\\")
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package GinHTMLRender
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want template.HTML
+	}{
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one\ntwo</p>\n<p>three</p>"},
+		{"heading", "## Title", "<h2>Title</h2>"},
+		{"list", "- a\n- *b*", "<ul><li>a</li><li><em>b</em></li></ul>"},
+		{"inline", "**bold** and `a*b*c`", "<p><strong>bold</strong> and <code>a*b*c</code></p>"},
+		{"code block", "```\n<b>\n```", "<pre><code>&lt;b&gt;</code></pre>"},
+		{"html", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"link", "[go](https://golang.org?a=1&b=2)", `<p><a href="https://golang.org?a=1&amp;b=2">go</a></p>`},
+		{"unsafe link", "[x](javascript:alert)", "<p>x</p>"},
+		{"protocol relative link", "[x](//evil.com)", "<p>x</p>"},
+		{"backslash relative link", `[x](/\evil.com)`, "<p>x</p>"},
+		{"unmatched backtick", "a ` b", "<p>a ` b</p>"},
+	}
+	for _, tt := range tests {
+		if got := markdown(tt.in); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	if got := truncate(5, "héllo world"); got != "héllo…" {
+		t.Errorf("got %q from truncate", got)
+	}
+	if got := truncate(20, "short"); got != "short" {
+		t.Errorf("got %q from truncate", got)
+	}
+	if got := truncate(-1, "short"); got != "…" {
+		t.Errorf("got %q from truncate", got)
+	}
+	if got := pluralize(1, "result", "results"); got != "1 result" {
+		t.Errorf("got %q from pluralize", got)
+	}
+	if got := pluralize(0, "result", "results"); got != "0 results" {
+		t.Errorf("got %q from pluralize", got)
+	}
+	if got := relative(3*time.Hour + time.Minute); got != "3 hours ago" {
+		t.Errorf("got %q from relative", got)
+	}
+	if got := relative(10 * time.Second); got != "just now" {
+		t.Errorf("got %q from relative", got)
+	}
+
+	at := time.Date(2016, 1, 2, 15, 4, 0, 0, time.Local)
+	if got, _ := date(at.UnixNano()/int64(time.Millisecond), "2006-01-02"); got != "2016-01-02" {
+		t.Errorf("got %q from date of milliseconds", got)
+	}
+	if got, _ := date(at); got != "Jan 2, 2016 15:04" {
+		t.Errorf("got %q from date", got)
+	}
+	if _, err := date("yesterday"); err == nil {
+		t.Error("got no error from date of a string")
+	}
+
+	if got, _ := toJSON(map[string]string{"a": "</script>"}); strings.Contains(string(got), `</script>`) {
+		t.Errorf("got %s from json", got)
+	}
+}
+
+func TestURLFor(t *testing.T) {
+	r := New()
+	r.Routes["article"] = "/blog/articles/:_id"
+	r.Routes["public"] = "/blog/public/*filepath"
+
+	tests := []struct {
+		name   string
+		route  string
+		params []interface{}
+		want   string
+		err    bool
+	}{
+		{"param", "article", []interface{}{"a b"}, "/blog/articles/a%20b", false},
+		{"wildcard", "public", []interface{}{"css/app.css"}, "/blog/public/css/app.css", false},
+		{"missing param", "article", nil, "", true},
+		{"extra param", "article", []interface{}{"a", "b"}, "", true},
+		{"unknown route", "nope", nil, "", true},
+	}
+	for _, tt := range tests {
+		got, err := r.URLFor(tt.route, tt.params...)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("%s: got %q and error %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layouts/default.html": `{{ shout "hi" }} {{ pluralize 2 "page" "pages" }}`,
+		"index.html":           ``,
+	})
+
+	for _, debug := range []bool{false, true} {
+		r := New()
+		r.TemplatesDir = dir
+		r.Layout = "layouts/default"
+		r.Debug = debug
+		r.Funcs["shout"] = strings.ToUpper
+		r.Create()
+
+		if got := execute(t, &r, "index", nil); got != "HI 2 pages" {
+			t.Errorf("debug %v: got %q", debug, got)
+		}
+	}
+}
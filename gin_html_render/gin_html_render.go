@@ -12,6 +12,7 @@
 // 		htmlRender.Layout = "layouts/default"
 // 		// htmlRender.TemplatesDir = "templates/" // default
 // 		// htmlRender.Ext = ".html"               // default
+// 		// htmlRender.Partials = "partials/"      // default
 //
 // 		// Tell gin to use our html render
 // 		router.HTMLRender = htmlRender.Create()
@@ -24,6 +25,8 @@
 // 		    |-- 404.html
 // 		    |-- layouts/
 // 		        |--- default.html
+// 		    |-- partials/
+// 		        |--- pager.html
 // 		    |-- articles/
 // 		        |--- list.html
 // 		        |--- form.html
@@ -33,12 +36,42 @@
 //
 // 		c.HTML(http.StatusOK, "articles/list", "")
 //
+// Templates can use the helpers listed in funcs and those added to Funcs
+//
+// 		htmlRender.Funcs["upper"] = strings.ToUpper
+//
+// Pages are rendered in Layout unless they choose another layout, or none,
+// on their first line. Layouts can extend other layouts the same way, they
+// then define the templates used by the layout they extend.
+//
+// 		{{/* layout: layouts/admin */}}
+// 		{{/* layout: none */}}
+//
+// Partials are parsed into every page, named after their path. To include
+// `templates/partials/pager.html`
+//
+// 		{{ template "partials/pager" .pager }}
+//
+// Templates are read from disk, or from FS, e.g. an embed.FS, in which case
+// TemplatesDir is the path of the templates in it. With DiskFallback, they are
+// read from disk in debug mode when TemplatesDir exists there, so that they
+// can be edited without rebuilding.
+//
+// 		//go:embed templates
+// 		var templates embed.FS
+//
+// 		htmlRender.FS = templates
+// 		htmlRender.DiskFallback = true
+//
 package GinHTMLRender
 
 import (
+	"errors"
+	"fmt"
 	"html/template"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
 
 	"github.com/gin-gonic/gin/render"
@@ -51,6 +84,12 @@ const (
 	Layout = "layout"
 	// Ext is the file extension of the rendered templates
 	Ext = ".html"
+	// Partials is the directory of the templates included in every page
+	Partials = "partials/"
+	// Layouts is the directory of the layouts, which are not pages
+	Layouts = "layouts/"
+	// NoLayout renders a page without layout, e.g. a fragment or an email
+	NoLayout = "none"
 	// Debug enables debug mode
 	Debug = false
 )
@@ -62,7 +101,31 @@ type Render struct {
 	TemplatesDir string
 	Layout       string
 	Ext          string
+	Partials     string
+	Layouts      string
 	Debug        bool
+
+	// PageLayouts maps page names to their layout, or to NoLayout, taking
+	// precedence over the front matter of the pages
+	PageLayouts map[string]string
+
+	// Funcs are added to the built-in helpers of every template, see funcs
+	Funcs template.FuncMap
+
+	// Routes maps the route names used by `urlFor` to their paths, e.g.
+	// "article": "/articles/:_id"
+	Routes map[string]string
+
+	// FS holds the templates instead of the disk, TemplatesDir is then the
+	// path of the templates in it. A dir FS does not hold is read from disk.
+	FS fs.FS
+
+	// DiskFallback reads the templates from TemplatesDir on disk rather than
+	// from FS in debug mode, if the dir exists
+	DiskFallback bool
+
+	// dir is the file system of the templates dir, see source
+	dir fs.FS
 }
 
 // Add assigns the name to the template
@@ -78,7 +141,7 @@ func (r *Render) Add(name string, tmpl *template.Template) {
 
 // AddFromFiles parses the files and returns the result
 func (r *Render) AddFromFiles(name string, files ...string) *template.Template {
-	tmpl := template.Must(template.ParseFiles(files...))
+	tmpl := template.Must(r.parseFiles(files...))
 	if r.Debug {
 		r.Files[name] = files
 	}
@@ -103,15 +166,57 @@ func (r *Render) Instance(name string, data interface{}) render.Render {
 	}
 }
 
-// loadTemplate parses the specified template and returns it
+// loadTemplate parses the specified template and returns it. The layouts and
+// partials are looked up again, so that changing them needs no restart.
 func (r *Render) loadTemplate(name string) *template.Template {
-	tpl, err := template.ParseFiles(r.Files[name]...)
+	files := r.Files[name]
+	if len(files) == 0 {
+		panic(name + " template name mismatch")
+	}
+	files, err := r.pageFiles(files[len(files)-1])
+	if err != nil {
+		panic(err.Error())
+	}
+	tpl, err := r.parseFiles(files...)
 	if err != nil {
 		panic(name + " template name mismatch")
 	}
 	return template.Must(tpl, err)
 }
 
+// parseFiles parses the files into one template and returns the first one
+// that is not a partial, i.e. the outermost layout or a page without layout.
+// Unlike template.ParseFiles, the templates are named after their path, e.g.
+// `partials/pager`, so that partials in different directories don't clash.
+func (r *Render) parseFiles(files ...string) (*template.Template, error) {
+	var root, entry *template.Template
+	for _, file := range files {
+		b, err := fs.ReadFile(r.templates(), file)
+		if err != nil {
+			return nil, err
+		}
+
+		name := r.getTemplateName(file)
+		var tmpl *template.Template
+		if root == nil {
+			root = template.New(name).Funcs(r.funcs())
+			tmpl = root
+		} else {
+			tmpl = root.New(name)
+		}
+		if _, err := tmpl.Parse(string(b)); err != nil {
+			return nil, err
+		}
+		if entry == nil && !r.isPartial(name) {
+			entry = tmpl
+		}
+	}
+	if entry == nil {
+		return root, nil
+	}
+	return entry, nil
+}
+
 // New returns a fresh instance of Render
 func New() Render {
 	return Render{
@@ -120,7 +225,12 @@ func New() Render {
 		TemplatesDir: TemplatesDir,
 		Layout:       Layout,
 		Ext:          Ext,
+		Partials:     Partials,
+		Layouts:      Layouts,
 		Debug:        Debug,
+		PageLayouts:  make(map[string]string),
+		Funcs:        make(template.FuncMap),
+		Routes:       make(map[string]string),
 	}
 }
 
@@ -129,34 +239,139 @@ func New() Render {
 func (r *Render) Create() *Render {
 	r.Validate()
 
-	layout := r.TemplatesDir + r.Layout + r.Ext
-
-	// root dir
-	tplRoot, err := filepath.Glob(r.TemplatesDir + "*" + r.Ext)
+	tpls, err := r.walk(".")
 	if err != nil {
 		panic(err.Error())
 	}
 
-	// sub dirs
-	tplSub, err := filepath.Glob(r.TemplatesDir + "**/*" + r.Ext)
-	if err != nil {
-		panic(err.Error())
-	}
-
-	for _, tpl := range append(tplRoot, tplSub...) {
+	for _, tpl := range tpls {
 
 		// This check is to prevent `panic: template: redefinition of template "layout"`
 		name := r.getTemplateName(tpl)
-		if name == r.Layout {
+		if r.isLayout(name) || r.isPartial(name) {
 			continue
 		}
 
-		r.AddFromFiles(name, layout, tpl)
+		files, err := r.pageFiles(tpl)
+		if err != nil {
+			panic(err.Error())
+		}
+		r.AddFromFiles(name, files...)
+		if r.Debug {
+			fmt.Printf("[GinHTMLRender] %-30s %s\n", name, r.describe(files))
+		}
 	}
 
 	return r
 }
 
+// Check returns an error if templates can not be rendered. In debug mode the
+// template files are parsed again, as they are for every request.
+func (r *Render) Check() error {
+	if len(r.Templates) == 0 {
+		return errors.New("no templates found in " + r.TemplatesDir)
+	}
+	if r.Debug {
+		for _, files := range r.Files {
+			files, err := r.pageFiles(files[len(files)-1])
+			if err != nil {
+				return err
+			}
+			if _, err := r.parseFiles(files...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// partials returns the files of the partials directory and its sub dirs,
+// which may not exist
+func (r *Render) partials() []string {
+	if len(r.Partials) == 0 {
+		return nil
+	}
+	dir := path.Clean(r.Partials)
+	if _, err := fs.Stat(r.templates(), dir); err != nil {
+		return nil
+	}
+
+	files, err := r.walk(dir)
+	if err != nil {
+		panic(err.Error())
+	}
+	return files
+}
+
+// walk returns the templates in the dir and all its sub dirs, in lexical
+// order
+func (r *Render) walk(dir string) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(r.templates(), dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.HasSuffix(file, r.Ext) {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// templates returns the file system of the templates dir, see source
+func (r *Render) templates() fs.FS {
+	if r.dir == nil {
+		dir, err := r.source()
+		if err != nil {
+			panic(err.Error())
+		}
+		r.dir = dir
+	}
+	return r.dir
+}
+
+// source returns the templates dir of FS, or of the disk without FS, if FS
+// does not hold the dir or in debug mode with DiskFallback
+func (r *Render) source() (fs.FS, error) {
+	if r.FS == nil {
+		return os.DirFS(r.TemplatesDir), nil
+	}
+	if r.Debug && r.DiskFallback {
+		if ok, _ := exists(r.TemplatesDir); ok {
+			fmt.Println("[GinHTMLRender] Reading the templates from", r.TemplatesDir, "on disk")
+			return os.DirFS(r.TemplatesDir), nil
+		}
+	}
+
+	dir := path.Clean(r.TemplatesDir)
+	if info, err := fs.Stat(r.FS, dir); err != nil || !info.IsDir() {
+		fmt.Println("[GinHTMLRender] Reading the templates from", r.TemplatesDir, "on disk, FS does not hold it")
+		return os.DirFS(r.TemplatesDir), nil
+	}
+	return fs.Sub(r.FS, dir)
+}
+
+// describe lists the layouts in the files of a page, outermost first, for the
+// debug listing
+func (r *Render) describe(files []string) string {
+	var names []string
+	for _, file := range files[:len(files)-1] {
+		if name := r.getTemplateName(file); !r.isPartial(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return NoLayout
+	}
+	return strings.Join(names, " > ")
+}
+
+// isPartial returns whether the template is a partial rather than a page
+func (r *Render) isPartial(name string) bool {
+	return len(r.Partials) > 0 && strings.HasPrefix(name, strings.TrimSuffix(r.Partials, "/")+"/")
+}
+
 // Validate checks if the directory and the layout files exist as expected
 // and configured
 func (r *Render) Validate() {
@@ -166,25 +381,22 @@ func (r *Render) Validate() {
 	}
 
 	// check for templates dir
-	if ok, _ := exists(r.TemplatesDir); !ok {
+	if _, err := fs.Stat(r.templates(), "."); err != nil {
 		panic(r.TemplatesDir + " directory for rendering templates does not exist.\n Configure this by setting htmlRender.TemplatesDir = \"your-tpl-dir/\"")
 	}
 
 	// check for layout file
-	layoutFile := r.TemplatesDir + r.Layout + r.Ext
-	if ok, _ := exists(layoutFile); !ok {
-		panic(layoutFile + " layout file does not exist")
+	if _, err := fs.Stat(r.templates(), r.Layout+r.Ext); err != nil {
+		panic(r.TemplatesDir + r.Layout + r.Ext + " layout file does not exist")
 	}
 }
 
 // getTemplateName returns the name of the template
-// For example, if the template path is `templates/articles/list.html`
-// getTemplateName would return `articles/list`
+// For example, if the template path is `articles/list.html` in the templates
+// dir getTemplateName would return `articles/list`. Paths in a fs.FS are
+// separated by slashes on every platform.
 func (r *Render) getTemplateName(tpl string) string {
-	dir, file := filepath.Split(tpl)
-	dir = strings.Replace(dir, r.TemplatesDir, "", 1)
-	file = strings.TrimSuffix(file, r.Ext)
-	return dir + file
+	return strings.TrimSuffix(tpl, r.Ext)
 }
 
 // exists returns whether the given file or directory exists or not
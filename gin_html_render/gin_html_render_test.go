@@ -0,0 +1,161 @@
+package GinHTMLRender
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// writeTemplates writes the files, keyed by their path, to a new templates
+// dir and returns it
+func writeTemplates(t *testing.T, files map[string]string) string {
+	dir := t.TempDir() + "/"
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// execute renders the template with the data and returns the output
+func execute(t *testing.T, r *Render, name string, data interface{}) string {
+	w := httptest.NewRecorder()
+	if err := r.Instance(name, data).Render(w); err != nil {
+		t.Fatal(err)
+	}
+	return w.Body.String()
+}
+
+func TestPartials(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layouts/default.html":  `<nav>{{ template "partials/navbar" . }}</nav>{{ template "content" . }}`,
+		"partials/navbar.html":  `{{ .user }}`,
+		"partials/cards/a.html": `<b>{{ . }}</b>`,
+		"articles/list.html":    `{{ define "content" }}{{ template "partials/cards/a" .title }}{{ end }}`,
+	})
+
+	for _, debug := range []bool{false, true} {
+		r := New()
+		r.TemplatesDir = dir
+		r.Layout = "layouts/default"
+		r.Debug = debug
+		r.Create()
+
+		if _, ok := r.Templates["partials/navbar"]; ok {
+			t.Errorf("debug %v: partials must not be pages", debug)
+		}
+		got := execute(t, &r, "articles/list", map[string]string{"user": "ann", "title": "Hi"})
+		if want := "<nav>ann</nav><b>Hi</b>"; got != want {
+			t.Errorf("debug %v: got %q, want %q", debug, got, want)
+		}
+	}
+}
+
+func TestPartialsReloadInDebug(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layouts/default.html": `{{ template "partials/navbar" . }}`,
+		"partials/navbar.html": `old`,
+		"index.html":           ``,
+	})
+
+	r := New()
+	r.TemplatesDir = dir
+	r.Layout = "layouts/default"
+	r.Debug = true
+	r.Create()
+
+	if err := ioutil.WriteFile(dir+"partials/navbar.html", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := execute(t, &r, "index", nil); !strings.Contains(got, "new") {
+		t.Errorf("got %q, want the changed partial", got)
+	}
+}
+
+func TestCreateRecursive(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layouts/default.html":         `{{ template "content" . }}`,
+		"partials/cards/deep/a.html":   `deep`,
+		"index.html":                   `{{ define "content" }}index{{ end }}`,
+		"admin/articles/list.html":     `{{ define "content" }}{{ template "partials/cards/deep/a" }}{{ end }}`,
+		"admin/articles/drafts/x.html": `{{ define "content" }}x{{ end }}`,
+		"admin/articles/notes.txt":     `not a template`,
+	})
+
+	r := New()
+	r.TemplatesDir = dir
+	r.Layout = "layouts/default"
+	r.Create()
+
+	var names []string
+	for name := range r.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != "admin/articles/drafts/x admin/articles/list index" {
+		t.Errorf("got templates %q", got)
+	}
+	if got := execute(t, &r, "admin/articles/list", nil); got != "deep" {
+		t.Errorf("got %q, want the nested partial", got)
+	}
+}
+
+func TestFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"views/layouts/default.html": {Data: []byte(`embedded {{ template "content" . }}`)},
+		"views/index.html":           {Data: []byte(`{{ define "content" }}index{{ end }}`)},
+		"other/layouts/default.html": {Data: []byte(`embedded {{ template "content" . }}`)},
+		"other/index.html":           {Data: []byte(`{{ define "content" }}index{{ end }}`)},
+	}
+
+	// Only views/ and local/ exist on disk
+	disk := writeTemplates(t, map[string]string{
+		"views/layouts/default.html": `disk {{ template "content" . }}`,
+		"views/index.html":           `{{ define "content" }}index{{ end }}`,
+		"local/layouts/default.html": `disk {{ template "content" . }}`,
+		"local/index.html":           `{{ define "content" }}index{{ end }}`,
+	})
+	wd, _ := os.Getwd()
+	if err := os.Chdir(disk); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		name     string
+		dir      string
+		debug    bool
+		fallback bool
+		want     string
+	}{
+		{"release", "views/", false, true, "embedded index"},
+		{"debug", "views/", true, true, "disk index"},
+		{"debug without fallback", "views/", true, false, "embedded index"},
+		{"debug without dir on disk", "other/", true, true, "embedded index"},
+		{"dir not in FS", "local/", false, true, "disk index"},
+		{"absolute dir", disk + "views/", false, true, "disk index"},
+	}
+	for _, tt := range tests {
+		r := New()
+		r.FS = fsys
+		r.DiskFallback = tt.fallback
+		r.TemplatesDir = tt.dir
+		r.Layout = "layouts/default"
+		r.Debug = tt.debug
+		r.Create()
+
+		if got := execute(t, &r, "index", nil); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
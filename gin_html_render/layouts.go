@@ -0,0 +1,90 @@
+package GinHTMLRender
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxNesting is how many layouts may extend each other
+	maxNesting = 10
+)
+
+// frontMatter matches the comment choosing the layout of a page or of a
+// layout, e.g. `{{/* layout: layouts/admin */}}` on its first line
+var frontMatter = regexp.MustCompile(`^\{\{-?\s*/\*\s*layout:\s*(\S+)\s*\*/\s*-?\}\}`)
+
+// layoutOf returns the layout named by the front matter of the file, or ""
+// if it has none
+func (r *Render) layoutOf(file string) (string, error) {
+	f, err := r.templates().Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if m := frontMatter.FindStringSubmatch(line); m != nil {
+			return m[1], nil
+		}
+		return "", nil
+	}
+	return "", scanner.Err()
+}
+
+// layoutFiles returns the files of the layout and of the layouts it extends,
+// outermost first, as the first file is the one executed
+func (r *Render) layoutFiles(layout string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	for len(layout) > 0 && layout != NoLayout {
+		if seen[layout] || len(seen) == maxNesting {
+			return nil, fmt.Errorf("layout %s extends itself or too many layouts", layout)
+		}
+		seen[layout] = true
+
+		file := layout + r.Ext
+		parent, err := r.layoutOf(file)
+		if err != nil {
+			return nil, fmt.Errorf("layout %s: %v", layout, err)
+		}
+		files = append([]string{file}, files...)
+		layout = parent
+	}
+	return files, nil
+}
+
+// pageFiles returns the files the page is parsed from: its layouts, the
+// partials and the page itself. The layout is taken from PageLayouts, the
+// front matter of the page or Layout, in that order.
+func (r *Render) pageFiles(page string) ([]string, error) {
+	layout, ok := r.PageLayouts[r.getTemplateName(page)]
+	if !ok {
+		var err error
+		if layout, err = r.layoutOf(page); err != nil {
+			return nil, err
+		}
+	}
+	if len(layout) == 0 {
+		layout = r.Layout
+	}
+
+	files, err := r.layoutFiles(layout)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, r.partials()...)
+	return append(files, page), nil
+}
+
+// isLayout returns whether the template is a layout rather than a page
+func (r *Render) isLayout(name string) bool {
+	return name == r.Layout || (len(r.Layouts) > 0 && strings.HasPrefix(name, strings.TrimSuffix(r.Layouts, "/")+"/"))
+}
@@ -0,0 +1,89 @@
+package GinHTMLRender
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLayouts(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layouts/default.html": `<main>{{ template "content" . }}</main>`,
+		"layouts/admin.html":   "{{/* layout: layouts/default */}}\n{{ define \"content\" }}<aside>admin</aside>{{ template \"admin\" . }}{{ end }}",
+		"index.html":           `{{ define "content" }}index{{ end }}`,
+		"admin/users.html":     "{{/* layout: layouts/admin */}}\n{{ define \"admin\" }}users{{ end }}",
+		"fragment.html":        "{{/* layout: none */ -}}\n<li>{{ . }}</li>",
+		"email.html":           `Hi {{ . }}{{ template "partials/sign" }}`,
+		"partials/footer.html": `footer`,
+		"partials/sign.html":   `, bye`,
+	})
+
+	for _, debug := range []bool{false, true} {
+		r := New()
+		r.TemplatesDir = dir
+		r.Layout = "layouts/default"
+		r.PageLayouts["email"] = NoLayout
+		r.Debug = debug
+		r.Create()
+
+		if _, ok := r.Templates["layouts/admin"]; ok {
+			t.Errorf("debug %v: layouts must not be pages", debug)
+		}
+
+		tests := []struct {
+			name string
+			want string
+		}{
+			{"index", "<main>index</main>"},
+			{"admin/users", "<main><aside>admin</aside>users</main>"},
+			{"fragment", "<li>ann</li>"},
+			{"email", "Hi ann, bye"},
+		}
+		for _, tt := range tests {
+			if got := strings.TrimSpace(execute(t, &r, tt.name, "ann")); got != tt.want {
+				t.Errorf("debug %v, %s: got %q, want %q", debug, tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestLayoutChangeInDebug(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layouts/default.html": `default {{ template "content" . }}`,
+		"layouts/other.html":   `other {{ template "content" . }}`,
+		"index.html":           `{{ define "content" }}index{{ end }}`,
+	})
+
+	r := New()
+	r.TemplatesDir = dir
+	r.Layout = "layouts/default"
+	r.Debug = true
+	r.Create()
+
+	page := "{{/* layout: layouts/other */}}\n{{ define \"content\" }}index{{ end }}"
+	if err := ioutil.WriteFile(dir+"index.html", []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := execute(t, &r, "index", nil); got != "other index" {
+		t.Errorf("got %q, want the page in the other layout", got)
+	}
+}
+
+func TestLayoutCycle(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layouts/default.html": "{{/* layout: layouts/a */}}",
+		"layouts/a.html":       "{{/* layout: layouts/default */}}",
+		"index.html":           ``,
+	})
+
+	r := New()
+	r.TemplatesDir = dir
+	r.Layout = "layouts/default"
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Create did not panic on layouts extending each other")
+		}
+	}()
+	r.Create()
+}
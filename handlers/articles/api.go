@@ -0,0 +1,219 @@
+package articles
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/madhums/go-gin-mgo-demo/middlewares"
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+const (
+	// APIPath is the path at which the articles resource of the JSON API is
+	// mounted
+	APIPath = "/api/v1/articles"
+)
+
+// APIList returns a page of articles as JSON. The other pages are linked in
+// the Link header.
+func APIList(c *gin.Context) {
+	store := c.MustGet("articles").(models.ArticleStore)
+	articles, pager, ok := find(c, store)
+	if !ok {
+		return
+	}
+	c.Header("Link", pager.Link())
+	c.JSON(http.StatusOK, gin.H{
+		"articles": articles,
+		"pager":    pager,
+	})
+}
+
+// APIGet returns a single article as JSON
+func APIGet(c *gin.Context) {
+	store := c.MustGet("articles").(models.ArticleStore)
+	oID := c.MustGet("_id").(bson.ObjectId)
+
+	article, err := store.Get(oID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("ETag", etag(article))
+	c.JSON(http.StatusOK, article)
+}
+
+// APICreate creates an article authored by the current user from the JSON
+// request body
+func APICreate(c *gin.Context) {
+	store := c.MustGet("articles").(models.ArticleStore)
+
+	article := models.Article{}
+	if err := c.BindJSON(&article); err != nil {
+		return
+	}
+
+	article.Id, article.Version = "", 0
+	article.User = middlewares.CurrentUser(c).Id
+	err := store.Create(&article)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("Location", middlewares.Path(c, APIPath+"/"+article.Id.Hex()))
+	c.Header("ETag", etag(article))
+	c.JSON(http.StatusCreated, article)
+}
+
+// APIUpdate replaces the editable fields of an article with the JSON request
+// body. The update only succeeds if the article is still at the version in
+// the If-Match header. Without the header it applies to the stored version.
+func APIUpdate(c *gin.Context) {
+	store := c.MustGet("articles").(models.ArticleStore)
+	oID := c.MustGet("_id").(bson.ObjectId)
+
+	stored, ok := editable(c, store, oID)
+	if !ok {
+		return
+	}
+
+	article := models.Article{}
+	if err := c.BindJSON(&article); err != nil {
+		return
+	}
+
+	apiSave(c, store, stored, article)
+}
+
+// APIPatch applies the JSON Merge Patch (RFC 7386) in the request body to an
+// article. Fields absent from the patch are left untouched and fields set to
+// null are removed. The update only succeeds if the article is still at the
+// version in the If-Match header. Without the header it applies to the
+// stored version.
+func APIPatch(c *gin.Context) {
+	store := c.MustGet("articles").(models.ArticleStore)
+	oID := c.MustGet("_id").(bson.ObjectId)
+
+	switch c.ContentType() {
+	case MIMEMergePatch, binding.MIMEJSON:
+	default:
+		c.Error(errUnsupportedPatch)
+		return
+	}
+
+	stored, ok := editable(c, store, oID)
+	if !ok {
+		return
+	}
+
+	article := models.Article{}
+	if err := mergePatch(c.Request.Body, stored, &article); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&article); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	apiSave(c, store, stored, article)
+}
+
+// APIDelete deletes an article
+func APIDelete(c *gin.Context) {
+	store := c.MustGet("articles").(models.ArticleStore)
+	oID := c.MustGet("_id").(bson.ObjectId)
+
+	if _, ok := editable(c, store, oID); !ok {
+		return
+	}
+
+	err := store.Delete(oID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// apiSave sets the fields of the article that differ from the stored article
+// and responds with the updated article. The version of the article is taken
+// from the If-Match header and defaults to the stored version.
+func apiSave(c *gin.Context, store models.ArticleStore, stored models.Article, article models.Article) {
+	version, err := ifMatch(c.Request.Header.Get("If-Match"), stored.Version)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	article.Version = version
+	submitted := article
+
+	current, err := store.Update(stored, &article)
+	if err == models.ErrConflict {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     middlewares.Classify(err),
+			"current":   current,
+			"submitted": submitted,
+		})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	article, err = store.Get(stored.Id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("ETag", etag(article))
+	c.JSON(http.StatusOK, article)
+}
+
+// etag returns the entity tag of the article, its quoted version
+func etag(article models.Article) string {
+	return `"` + strconv.Itoa(article.Version) + `"`
+}
+
+// ifMatch returns the version an update must apply to according to the
+// If-Match header. Without header or with `*` it is the stored version. Tags
+// are compared strongly (RFC 7232), weak tags are rejected as they never
+// match.
+func ifMatch(header string, stored int) (int, error) {
+	if len(strings.TrimSpace(header)) == 0 {
+		return stored, nil
+	}
+
+	versions := []int{}
+	matched := false
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			matched = true
+			continue
+		}
+		if strings.HasPrefix(tag, "W/") {
+			return 0, fmt.Errorf("weak entity tag %s in If-Match, send the ETag as is", tag)
+		}
+		if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+			return 0, fmt.Errorf("invalid If-Match header %q", header)
+		}
+		version, err := strconv.Atoi(tag[1 : len(tag)-1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid If-Match header %q", header)
+		}
+		matched = matched || version == stored
+		versions = append(versions, version)
+	}
+	if matched {
+		return stored, nil
+	}
+	return versions[0], nil
+}
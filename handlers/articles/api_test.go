@@ -0,0 +1,31 @@
+package articles
+
+import "testing"
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"", 3},
+		{"  ", 3},
+		{"*", 3},
+		{`"3"`, 3},
+		{`"2"`, 2},
+		{`"1", "3"`, 3},
+		{`"1", "2"`, 1},
+		{`"1", *`, 3},
+	}
+	for _, tt := range tests {
+		got, err := ifMatch(tt.header, 3)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %d and error %v, want %d", tt.header, got, err, tt.want)
+		}
+	}
+
+	for _, header := range []string{`W/"3"`, `"3", W/"3"`, "3", `"x"`, `"`, `"3`, `"2",`} {
+		if _, err := ifMatch(header, 3); err == nil {
+			t.Errorf("%q: got no error", header)
+		}
+	}
+}
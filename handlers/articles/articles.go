@@ -2,12 +2,11 @@ package articles
 
 import (
 	"net/http"
-	"time"
 
-	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/gin-gonic/gin"
+	"github.com/madhums/go-gin-mgo-demo/middlewares"
 	"github.com/madhums/go-gin-mgo-demo/models"
 )
 
@@ -15,91 +14,127 @@ import (
 func New(c *gin.Context) {
 	article := models.Article{}
 
-	c.HTML(http.StatusOK, "articles/form", gin.H{
-		"title":   "New article",
-		"article": article,
+	middlewares.HTML(c, http.StatusOK, "articles/form", gin.H{
+		"title":    "New article",
+		"article":  article,
+		"editable": true,
 	})
 }
 
-// Create an article
+// Create an article authored by the current user
 func Create(c *gin.Context) {
-	db := c.MustGet("db").(*mgo.Database)
+	store := c.MustGet("articles").(models.ArticleStore)
 
 	article := models.Article{}
 	err := c.Bind(&article)
 	if err != nil {
-		c.Error(err)
 		return
 	}
 
-	err = db.C(models.CollectionArticle).Insert(article)
+	article.Id, article.Version = "", 0
+	article.User = middlewares.CurrentUser(c).Id
+	err = store.Create(&article)
 	if err != nil {
 		c.Error(err)
+		return
 	}
-	c.Redirect(http.StatusMovedPermanently, "/articles")
+	c.Redirect(http.StatusMovedPermanently, middlewares.Path(c, "/articles"))
 }
 
-// Edit an article
+// Edit an article. Users who may not edit it get a read-only page.
 func Edit(c *gin.Context) {
-	db := c.MustGet("db").(*mgo.Database)
-	article := models.Article{}
-	oID := bson.ObjectIdHex(c.Param("_id"))
-	err := db.C(models.CollectionArticle).FindId(oID).One(&article)
+	store := c.MustGet("articles").(models.ArticleStore)
+	oID := c.MustGet("_id").(bson.ObjectId)
+	article, err := store.Get(oID)
 	if err != nil {
 		c.Error(err)
+		return
 	}
 
-	c.HTML(http.StatusOK, "articles/form", gin.H{
-		"title":   "Edit article",
-		"article": article,
+	user := middlewares.CurrentUser(c)
+	middlewares.HTML(c, http.StatusOK, "articles/form", gin.H{
+		"title":    "Edit article",
+		"article":  article,
+		"editable": user.CanEdit(article),
 	})
 }
 
-// List all articles
+// List articles, one page at a time
 func List(c *gin.Context) {
-	db := c.MustGet("db").(*mgo.Database)
-	articles := []models.Article{}
-	err := db.C(models.CollectionArticle).Find(nil).Sort("-updated_on").All(&articles)
-	if err != nil {
-		c.Error(err)
+	store := c.MustGet("articles").(models.ArticleStore)
+	articles, pager, ok := find(c, store)
+	if !ok {
+		return
 	}
-	c.HTML(http.StatusOK, "articles/list", gin.H{
+	middlewares.HTML(c, http.StatusOK, "articles/list", gin.H{
 		"title":    "Articles",
 		"articles": articles,
+		"pager":    pager,
+		"sort":     c.DefaultQuery("sort", models.DefaultSort),
 	})
 }
 
-// Update an article
+// Update an article of the current user
 func Update(c *gin.Context) {
-	db := c.MustGet("db").(*mgo.Database)
+	store := c.MustGet("articles").(models.ArticleStore)
+	oID := c.MustGet("_id").(bson.ObjectId)
+
+	stored, ok := editable(c, store, oID)
+	if !ok {
+		return
+	}
 
 	article := models.Article{}
 	err := c.Bind(&article)
 	if err != nil {
-		c.Error(err)
 		return
 	}
 
-	query := bson.M{"_id": bson.ObjectIdHex(c.Param("_id"))}
-	doc := bson.M{
-		"title":      article.Title,
-		"body":       article.Body,
-		"updated_on": time.Now().UnixNano() / int64(time.Millisecond),
+	submitted := article
+	current, err := store.Update(stored, &article)
+	if err == models.ErrConflict {
+		middlewares.HTML(c, http.StatusConflict, "articles/conflict", gin.H{
+			"title":     "Conflict",
+			"current":   current,
+			"submitted": submitted,
+		})
+		return
 	}
-	err = db.C(models.CollectionArticle).Update(query, doc)
 	if err != nil {
 		c.Error(err)
+		return
 	}
-	c.Redirect(http.StatusMovedPermanently, "/articles")
+	c.Redirect(http.StatusMovedPermanently, middlewares.Path(c, "/articles"))
 }
 
-// Delete an article
+// Delete an article of the current user
 func Delete(c *gin.Context) {
-	db := c.MustGet("db").(*mgo.Database)
-	query := bson.M{"_id": bson.ObjectIdHex(c.Param("_id"))}
-	err := db.C(models.CollectionArticle).Remove(query)
+	store := c.MustGet("articles").(models.ArticleStore)
+	oID := c.MustGet("_id").(bson.ObjectId)
+
+	if _, ok := editable(c, store, oID); !ok {
+		return
+	}
+
+	err := store.Delete(oID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Redirect(http.StatusMovedPermanently, middlewares.Path(c, "/articles"))
+}
+
+// editable returns the article if the current user may edit it. It returns
+// false if an error was reported.
+func editable(c *gin.Context, store models.ArticleStore, oID bson.ObjectId) (models.Article, bool) {
+	article, err := store.Get(oID)
 	if err != nil {
 		c.Error(err)
+		return article, false
+	}
+	if !middlewares.CurrentUser(c).CanEdit(article) {
+		c.Error(middlewares.ErrForbidden)
+		return article, false
 	}
-	c.Redirect(http.StatusMovedPermanently, "/articles")
+	return article, true
 }
@@ -0,0 +1,72 @@
+package articles
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/madhums/go-gin-mgo-demo/middlewares"
+)
+
+const (
+	// MIMEMergePatch is the content type of JSON Merge Patch documents
+	MIMEMergePatch = "application/merge-patch+json"
+)
+
+var (
+	errUnsupportedPatch = &middlewares.HTTPError{
+		Status:  http.StatusUnsupportedMediaType,
+		Code:    middlewares.ErrorUnsupportedMediaType,
+		Message: "patches must be sent as " + MIMEMergePatch + " or application/json",
+	}
+	errInvalidPatch = errors.New("a merge patch must be a JSON object")
+)
+
+// mergePatch applies the JSON Merge Patch read from r to the JSON
+// representation of target and decodes the result into out
+func mergePatch(r io.Reader, target interface{}, out interface{}) error {
+	var patch interface{}
+	if err := json.NewDecoder(r).Decode(&patch); err != nil {
+		return err
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return errInvalidPatch
+	}
+
+	data, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(merge(doc, patch))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// merge implements the MergePatch function of RFC 7386
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = merge(t[key], value)
+	}
+	return t
+}
@@ -0,0 +1,69 @@
+package articles
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+func TestMergePatch(t *testing.T) {
+	stored := models.Article{
+		Id:      bson.NewObjectId(),
+		Title:   "Hello",
+		Body:    "World",
+		Version: 3,
+	}
+
+	tests := []struct {
+		name  string
+		patch string
+		title string
+		body  string
+	}{
+		{"empty", `{}`, "Hello", "World"},
+		{"title", `{"title":"Bye"}`, "Bye", "World"},
+		{"both", `{"title":"Bye","body":"Text"}`, "Bye", "Text"},
+		{"null removes", `{"body":null}`, "Hello", ""},
+		{"unknown field", `{"nope":{"a":1}}`, "Hello", "World"},
+	}
+	for _, tt := range tests {
+		article := models.Article{}
+		if err := mergePatch(strings.NewReader(tt.patch), stored, &article); err != nil {
+			t.Errorf("%s: got error %v", tt.name, err)
+			continue
+		}
+		if article.Title != tt.title || article.Body != tt.body || article.Id != stored.Id || article.Version != stored.Version {
+			t.Errorf("%s: got %+v, want title %q and body %q on the stored article", tt.name, article, tt.title, tt.body)
+		}
+	}
+
+	for _, patch := range []string{`[{"op":"remove","path":"/body"}]`, `"title"`, `{"title":`, `{"title":1}`} {
+		if err := mergePatch(strings.NewReader(patch), stored, &models.Article{}); err == nil {
+			t.Errorf("%s: got no error", patch)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	target := map[string]interface{}{
+		"a": "b",
+		"c": map[string]interface{}{"d": "e", "f": "g"},
+	}
+	patch := map[string]interface{}{
+		"a": "z",
+		"c": map[string]interface{}{"f": nil},
+	}
+
+	got := merge(target, patch).(map[string]interface{})
+	c := got["c"].(map[string]interface{})
+	if got["a"] != "z" || c["d"] != "e" || len(c) != 1 {
+		t.Errorf("got %v, want a replaced and c.f removed", got)
+	}
+
+	if got := merge(target, "x"); got != "x" {
+		t.Errorf("got %v, want a patch that is not an object to replace the target", got)
+	}
+}
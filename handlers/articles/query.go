@@ -0,0 +1,166 @@
+package articles
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+// Pager holds the pagination state and links of a list of articles
+type Pager struct {
+	Page       int    `json:"page,omitempty"`
+	Pages      int    `json:"pages,omitempty"`
+	Limit      int    `json:"limit"`
+	Total      int    `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	First      string `json:"-"`
+	Prev       string `json:"-"`
+	Next       string `json:"-"`
+	Last       string `json:"-"`
+}
+
+// Link returns the value of the Link header pointing at the other pages
+func (p *Pager) Link() string {
+	links := []string{}
+	for _, l := range []struct{ rel, url string }{
+		{"first", p.First},
+		{"prev", p.Prev},
+		{"next", p.Next},
+		{"last", p.Last},
+	} {
+		if len(l.url) > 0 {
+			links = append(links, fmt.Sprintf("<%s>; rel=\"%s\"", l.url, l.rel))
+		}
+	}
+	return strings.Join(links, ", ")
+}
+
+// find lists the articles requested by the query string of the request. It
+// returns false if an error was reported.
+func find(c *gin.Context, store models.ArticleStore) ([]models.Article, *Pager, bool) {
+	q, err := parseQuery(c.Request.URL.Query())
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return nil, nil, false
+	}
+
+	articles, more, err := store.List(q)
+	if err != nil {
+		c.Error(err)
+		return nil, nil, false
+	}
+
+	pager := &Pager{Limit: q.Limit}
+	u := *c.Request.URL
+
+	if more && q.SortField() == "updated_on" {
+		pager.NextCursor = models.NewCursor(articles[len(articles)-1]).String()
+	}
+
+	if q.Cursor != nil {
+		pager.First = pageURL(u, "page", "")
+		if more {
+			pager.Next = pageURL(u, "cursor", pager.NextCursor)
+		}
+		return articles, pager, true
+	}
+
+	total, err := store.Count(q)
+	if err != nil {
+		c.Error(err)
+		return nil, nil, false
+	}
+
+	pager.Page = q.Page
+	pager.Total = total
+	pager.Pages = (total + q.Limit - 1) / q.Limit
+	if pager.Pages > 1 {
+		pager.First = pageURL(u, "page", "1")
+		pager.Last = pageURL(u, "page", strconv.Itoa(pager.Pages))
+	}
+	if q.Page > 1 {
+		pager.Prev = pageURL(u, "page", strconv.Itoa(q.Page-1))
+	}
+	if more {
+		pager.Next = pageURL(u, "page", strconv.Itoa(q.Page+1))
+	}
+	return articles, pager, true
+}
+
+// parseQuery reads the pagination, sorting and filtering parameters
+//
+//	page   page number, starting at 1
+//	limit  number of articles per page
+//	sort   field to sort by, prefixed with `-` for descending order
+//	from   only articles updated on or after this date
+//	to     only articles updated on or before this date
+//	cursor next_cursor of the previous page
+func parseQuery(values url.Values) (models.ArticleQuery, error) {
+	q := models.NewArticleQuery()
+
+	var err error
+	if v := values.Get("page"); len(v) > 0 {
+		if q.Page, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("invalid page %q", v)
+		}
+	}
+	if v := values.Get("limit"); len(v) > 0 {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("invalid limit %q", v)
+		}
+	}
+	if v := values.Get("sort"); len(v) > 0 {
+		q.Sort = v
+	}
+	if v := values.Get("from"); len(v) > 0 {
+		if q.From, _, err = parseDate(v); err != nil {
+			return q, fmt.Errorf("invalid from date %q", v)
+		}
+	}
+	if v := values.Get("to"); len(v) > 0 {
+		to, dateOnly, err := parseDate(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid to date %q", v)
+		}
+		// A date without time includes the whole day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		q.To = to
+	}
+	if v := values.Get("cursor"); len(v) > 0 {
+		if q.Cursor, err = models.ParseCursor(v); err != nil {
+			return q, err
+		}
+	}
+
+	return q, q.Validate()
+}
+
+// parseDate parses dates like `2015-08-01` and timestamps like
+// `2015-08-01T10:00:00Z`. It also reports whether the value was a date only.
+func parseDate(v string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, false, err
+}
+
+// pageURL returns the url with the query parameter set to value. Changing the
+// page or the cursor drops the other one. An empty value removes the parameter.
+func pageURL(u url.URL, key, value string) string {
+	values := u.Query()
+	values.Del("page")
+	values.Del("cursor")
+	if len(value) > 0 {
+		values.Set(key, value)
+	}
+	u.RawQuery = values.Encode()
+	return u.String()
+}
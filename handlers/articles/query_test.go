@@ -0,0 +1,64 @@
+package articles
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+func TestParseQuery(t *testing.T) {
+	day := time.Date(2015, 8, 1, 0, 0, 0, 0, time.UTC)
+	cursor := models.Cursor{UpdatedOn: day, Id: bson.NewObjectId()}
+
+	tests := []struct {
+		query string
+		want  models.ArticleQuery
+	}{
+		{"", models.NewArticleQuery()},
+		{"page=3&limit=5&sort=title", models.ArticleQuery{Page: 3, Limit: 5, Sort: "title"}},
+		{"page=0&limit=1000", models.ArticleQuery{Page: 1, Limit: models.MaxLimit, Sort: models.DefaultSort}},
+		{"from=2015-08-01&to=2015-08-01", models.ArticleQuery{Page: 1, Limit: models.DefaultLimit, Sort: models.DefaultSort, From: day, To: day.AddDate(0, 0, 1)}},
+		{"to=2015-08-01T10:00:00Z", models.ArticleQuery{Page: 1, Limit: models.DefaultLimit, Sort: models.DefaultSort, To: day.Add(10 * time.Hour)}},
+		{"cursor=" + cursor.String(), models.ArticleQuery{Page: 1, Limit: models.DefaultLimit, Sort: models.DefaultSort, Cursor: &cursor}},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		got, err := parseQuery(values)
+		if err != nil {
+			t.Errorf("%q: got error %v", tt.query, err)
+			continue
+		}
+		if got.Page != tt.want.Page || got.Limit != tt.want.Limit || got.Sort != tt.want.Sort ||
+			!got.From.Equal(tt.want.From) || !got.To.Equal(tt.want.To) ||
+			(got.Cursor == nil) != (tt.want.Cursor == nil) ||
+			(got.Cursor != nil && (!got.Cursor.UpdatedOn.Equal(tt.want.Cursor.UpdatedOn) || got.Cursor.Id != tt.want.Cursor.Id)) {
+			t.Errorf("%q: got %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+
+	invalid := []struct {
+		query   string
+		message string
+	}{
+		{"page=x", "invalid page"},
+		{"page=922337203685477580", "use the cursor"},
+		{"limit=x", "invalid limit"},
+		{"sort=body", "can not sort by"},
+		{"from=yesterday", "invalid from date"},
+		{"to=2015-13-01", "invalid to date"},
+		{"from=2015-08-02&to=2015-08-01T10:00:00Z", "to must not be before from"},
+		{"cursor=nope", "invalid cursor"},
+		{"sort=title&cursor=" + cursor.String(), "cursors can only be used"},
+	}
+	for _, tt := range invalid {
+		values, _ := url.ParseQuery(tt.query)
+		if _, err := parseQuery(values); err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%q: got error %v, want %q", tt.query, err, tt.message)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package articles
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/madhums/go-gin-mgo-demo/middlewares"
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+const (
+	// snippetLength is the approximate number of characters of the body shown
+	// around the first match
+	snippetLength = 160
+)
+
+var (
+	errMissingQuery = errors.New("missing search query q")
+)
+
+// Hit is a search result along with the highlighted parts of the article
+type Hit struct {
+	models.SearchResult
+	TitleHTML template.HTML `json:"-"`
+	Snippet   template.HTML `json:"snippet"`
+}
+
+// Search articles by title and body
+func Search(c *gin.Context) {
+	store := c.MustGet("articles").(models.ArticleStore)
+	query := strings.TrimSpace(c.Query("q"))
+
+	hits := []Hit{}
+	pager := &Pager{}
+	if len(query) > 0 {
+		var ok bool
+		if hits, pager, ok = search(c, store, query); !ok {
+			return
+		}
+	}
+
+	middlewares.HTML(c, http.StatusOK, "articles/search", gin.H{
+		"title": "Search",
+		"query": query,
+		"hits":  hits,
+		"pager": pager,
+	})
+}
+
+// APISearch returns the articles matching the `q` query parameter as JSON,
+// most relevant first
+func APISearch(c *gin.Context) {
+	store := c.MustGet("articles").(models.ArticleStore)
+	query := strings.TrimSpace(c.Query("q"))
+	if len(query) == 0 {
+		c.Error(errMissingQuery).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	hits, pager, ok := search(c, store, query)
+	if !ok {
+		return
+	}
+	c.Header("Link", pager.Link())
+	c.JSON(http.StatusOK, gin.H{
+		"query":   query,
+		"results": hits,
+		"pager":   pager,
+	})
+}
+
+// search runs a full-text search for the query in the article store. It
+// returns false if an error was reported.
+func search(c *gin.Context, store models.ArticleStore, query string) ([]Hit, *Pager, bool) {
+	q, err := parseQuery(c.Request.URL.Query())
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return nil, nil, false
+	}
+
+	results, total, err := store.Search(query, q)
+	if err != nil {
+		c.Error(err)
+		return nil, nil, false
+	}
+
+	terms := strings.Fields(query)
+	hits := make([]Hit, len(results))
+	for i, result := range results {
+		hits[i] = Hit{
+			SearchResult: result,
+			TitleHTML:    highlight(result.Title, terms),
+			Snippet:      highlight(excerpt(result.Body, terms), terms),
+		}
+	}
+
+	u := *c.Request.URL
+	pager := &Pager{
+		Page:  q.Page,
+		Limit: q.Limit,
+		Total: total,
+		Pages: (total + q.Limit - 1) / q.Limit,
+	}
+	if q.Page > 1 {
+		pager.Prev = pageURL(u, "page", strconv.Itoa(q.Page-1))
+	}
+	if q.Page < pager.Pages {
+		pager.Next = pageURL(u, "page", strconv.Itoa(q.Page+1))
+	}
+	return hits, pager, true
+}
+
+// termsPattern returns a case insensitive pattern matching any of the terms
+func termsPattern(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(strings.Trim(term, `"-`))
+	}
+	return regexp.MustCompile(`(?i)(` + strings.Join(quoted, "|") + `)`)
+}
+
+// excerpt returns about snippetLength characters of the text around the first
+// match of the terms
+func excerpt(text string, terms []string) string {
+	runes := []rune(text)
+	if len(runes) <= snippetLength {
+		return text
+	}
+
+	start := 0
+	if loc := termsPattern(terms).FindStringIndex(text); loc != nil {
+		start = len([]rune(text[:loc[0]])) - snippetLength/4
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetLength
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet = snippet + "…"
+	}
+	return snippet
+}
+
+// highlight escapes the text and wraps every match of the terms in <mark>
+func highlight(text string, terms []string) template.HTML {
+	pattern := termsPattern(terms)
+	parts := []string{}
+	last := 0
+	for _, loc := range pattern.FindAllStringIndex(text, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		parts = append(parts,
+			template.HTMLEscapeString(text[last:loc[0]]),
+			"<mark>"+template.HTMLEscapeString(text[loc[0]:loc[1]])+"</mark>",
+		)
+		last = loc[1]
+	}
+	parts = append(parts, template.HTMLEscapeString(text[last:]))
+	return template.HTML(strings.Join(parts, ""))
+}
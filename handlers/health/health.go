@@ -0,0 +1,105 @@
+// Package health serves the endpoints load balancers and orchestrators probe
+// to know whether the server is alive and ready to take requests.
+package health
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// Version and Commit describe the build. Set them when building with
+	// -ldflags "-X github.com/madhums/go-gin-mgo-demo/handlers/health.Version=1.0.0"
+	Version = "dev"
+	Commit  = ""
+
+	// started is when the process started
+	started = time.Now()
+)
+
+// Check is a named check of a dependency the server needs to take requests
+type Check struct {
+	Name string
+	Run  func() error
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration_ms"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Build describes the running build
+type Build struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	Go      string `json:"go"`
+}
+
+// Live responds 200 as long as the process serves requests
+func Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"uptime": time.Since(started).Truncate(time.Second).String(),
+		"build":  build(),
+	})
+}
+
+// Ready returns the handler running the checks. It responds 200 if all of
+// them pass and 503 otherwise, with the result of each check.
+// Usage: router.GET("/readyz", health.Ready(health.Check{"database", db.Ping}))
+func Ready(checks ...Check) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		status, code := "ok", http.StatusOK
+
+		results := make([]Result, len(checks))
+		for i, check := range checks {
+			results[i] = run(check)
+			if results[i].Status != "ok" {
+				status, code = "unavailable", http.StatusServiceUnavailable
+			}
+		}
+
+		c.JSON(code, gin.H{
+			"status":      status,
+			"checks":      results,
+			"duration_ms": milliseconds(time.Since(start)),
+			"build":       build(),
+		})
+	}
+}
+
+// run runs the check and times it
+func run(check Check) Result {
+	start := time.Now()
+	err := check.Run()
+	result := Result{
+		Name:     check.Name,
+		Status:   "ok",
+		Duration: milliseconds(time.Since(start)),
+	}
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func build() Build {
+	return Build{
+		Version: Version,
+		Commit:  Commit,
+		Go:      runtime.Version(),
+	}
+}
+
+// milliseconds returns the duration in milliseconds, to the microsecond
+func milliseconds(d time.Duration) float64 {
+	return float64(d/time.Microsecond) / 1000
+}
@@ -0,0 +1,51 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReady(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ok := Check{Name: "ok", Run: func() error { return nil }}
+	failed := Check{Name: "failed", Run: func() error { return errors.New("down") }}
+
+	tests := []struct {
+		name   string
+		checks []Check
+		status int
+		failed int
+	}{
+		{"no checks", nil, http.StatusOK, 0},
+		{"passing", []Check{ok}, http.StatusOK, 0},
+		{"failing", []Check{ok, failed}, http.StatusServiceUnavailable, 1},
+	}
+	for _, tt := range tests {
+		router := gin.New()
+		router.GET("/readyz", Ready(tt.checks...))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.status)
+		}
+		body := struct{ Checks []Result }{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		failures := 0
+		for _, result := range body.Checks {
+			if result.Status != "ok" {
+				failures++
+			}
+		}
+		if len(body.Checks) != len(tt.checks) || failures != tt.failed {
+			t.Errorf("%s: got %d checks with %d failures", tt.name, len(body.Checks), failures)
+		}
+	}
+}
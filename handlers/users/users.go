@@ -0,0 +1,107 @@
+package users
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/madhums/go-gin-mgo-demo/middlewares"
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+// New user registration form
+func New(c *gin.Context) {
+	middlewares.HTML(c, http.StatusOK, "users/register", gin.H{
+		"title": "Register",
+		"user":  models.Registration{},
+	})
+}
+
+// Create a user and log them in
+func Create(c *gin.Context) {
+	store := c.MustGet("users").(models.UserStore)
+
+	registration := models.Registration{}
+	err := c.Bind(&registration)
+	if err != nil {
+		return
+	}
+
+	user := registration.User()
+	err = store.Create(&user)
+	if err == models.ErrEmailTaken {
+		middlewares.HTML(c, http.StatusUnprocessableEntity, "users/register", gin.H{
+			"title": "Register",
+			"user":  registration,
+			"error": "An account with this email already exists.",
+		})
+		return
+	}
+	if err == models.ErrPasswordTooLong {
+		middlewares.HTML(c, http.StatusUnprocessableEntity, "users/register", gin.H{
+			"title": "Register",
+			"user":  registration,
+			"error": "The password must be at most 72 bytes long.",
+		})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	middlewares.Login(c, &user)
+	c.Redirect(http.StatusFound, middlewares.Path(c, "/articles"))
+}
+
+// LoginForm renders the login page
+func LoginForm(c *gin.Context) {
+	middlewares.HTML(c, http.StatusOK, "users/login", gin.H{
+		"title": "Log in",
+		"next":  c.Query("next"),
+	})
+}
+
+// Login checks the credentials and starts a session
+func Login(c *gin.Context) {
+	store := c.MustGet("users").(models.UserStore)
+
+	credentials := models.Credentials{}
+	err := c.Bind(&credentials)
+	if err != nil {
+		return
+	}
+
+	user, err := store.GetByEmail(credentials.Email)
+	if err != nil && err != models.ErrNotFound {
+		c.Error(err)
+		return
+	}
+	if err == models.ErrNotFound || !user.CheckPassword(credentials.Password) {
+		middlewares.HTML(c, http.StatusUnauthorized, "users/login", gin.H{
+			"title": "Log in",
+			"next":  c.PostForm("next"),
+			"email": credentials.Email,
+			"error": "Wrong email or password.",
+		})
+		return
+	}
+
+	middlewares.Login(c, &user)
+	c.Redirect(http.StatusFound, redirectTarget(c, c.PostForm("next")))
+}
+
+// Logout ends the session
+func Logout(c *gin.Context) {
+	middlewares.Logout(c)
+	c.Redirect(http.StatusFound, middlewares.Path(c, "/articles"))
+}
+
+// redirectTarget returns the page to go to after logging in. Only paths on
+// this site are allowed.
+func redirectTarget(c *gin.Context, next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return middlewares.Path(c, "/articles")
+	}
+	return next
+}
@@ -3,68 +3,182 @@
 package main
 
 import (
-	"net/http"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"os"
 
-	"github.com/gin-gonic/gin"
+	"github.com/madhums/go-gin-mgo-demo/config"
 	"github.com/madhums/go-gin-mgo-demo/db"
-	"github.com/madhums/go-gin-mgo-demo/gin_html_render"
-	"github.com/madhums/go-gin-mgo-demo/handlers/articles"
 	"github.com/madhums/go-gin-mgo-demo/middlewares"
+	"github.com/madhums/go-gin-mgo-demo/models"
+	"github.com/madhums/go-gin-mgo-demo/server"
 )
 
-const (
-	// Port at which the server starts listening
-	Port = "7000"
-)
+func main() {
+	cfg, args, err := config.Load(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	options := cfg.DBOptions()
+
+	// Commands
+	if len(args) > 0 {
+		if args[0] == "config" {
+			printConfig(cfg, args[1:])
+			return
+		}
+
+		options.Degraded = false
+		connect(options)
+
+		switch args[0] {
+		case "indexes":
+			indexes()
+			return
+		case "admin":
+			admin(args[1:])
+			return
+		default:
+			fmt.Printf("Unknown command %q\n", args[0])
+			os.Exit(2)
+		}
+	}
+
+	if len(cfg.SessionSecret) > 0 {
+		middlewares.SessionSecret = []byte(cfg.SessionSecret)
+	} else {
+		fmt.Println("SESSION_SECRET is not set, sessions will not survive restarts")
+	}
+
+	// Indexes and migrations run once mongo is reached, which may be after
+	// the server started when running degraded
+	options.OnConnect = prepare
+	connect(options)
+
+	// Close the database once requests finished, which saves the in-memory
+	// stores and closes the file store
+	server.OnShutdown("database", db.Close)
 
-func init() {
-	db.Connect()
+	// Start listening
+	serverConfig := server.Config{
+		BasePath:     cfg.BasePath,
+		TemplatesDir: cfg.Templates.Dir,
+		PublicDir:    cfg.PublicDir,
+		Layout:       cfg.Templates.Layout,
+		Ext:          cfg.Templates.Ext,
+		Debug:        cfg.Templates.Debug,
+		ReadSession:  cfg.ReadSession(),
+	}
+	if cfg.Embedded() {
+		serverConfig.FS = assets
+	}
+	handler := server.NewServer(serverConfig)
+	if err := server.ListenAndServe(":"+cfg.Port, handler, cfg.ShutdownTimeout.Duration); err != nil {
+		fmt.Printf("Server stopped, go error %v\n", err)
+		os.Exit(1)
+	}
 }
 
-func main() {
+// connect connects to the database or exits
+func connect(options db.Options) {
+	if err := db.Connect(options); err != nil {
+		fmt.Printf("Can't connect to the database, go error %v\n", err)
+		os.Exit(1)
+	}
+}
 
-	// Configure
-	router := gin.Default()
+// prepare ensures the indexes and migrates the articles of mongo
+func prepare() error {
+	s, err := db.Clone()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	database := s.DB(db.Mongo.Database)
 
-	// Set html render options
-	htmlRender := GinHTMLRender.New()
-	htmlRender.Debug = gin.IsDebugging()
-	htmlRender.Layout = "layouts/default"
-	// htmlRender.TemplatesDir = "templates/" // default
-	// htmlRender.Ext = ".html"               // default
+	if err := db.EnsureIndexes(database); err != nil {
+		return fmt.Errorf("can't ensure indexes: %v", err)
+	}
 
-	// Tell gin to use our html render
-	router.HTMLRender = htmlRender.Create()
+	migrated, err := models.MigrateTimestamps(database)
+	if err != nil {
+		return fmt.Errorf("can't migrate timestamps: %v", err)
+	}
+	if migrated > 0 {
+		fmt.Println("Migrated the timestamps of", migrated, "articles")
+	}
+	return nil
+}
 
-	router.RedirectTrailingSlash = true
-	router.RedirectFixedPath = true
+// indexes prints the report of missing and extra indexes. It exits with a
+// non-zero status if any registered index is missing.
+func indexes() {
+	if db.Shared != nil {
+		fmt.Println("Indexes are only used with mongo")
+		return
+	}
 
-	// Middlewares
-	router.Use(middlewares.Connect)
-	router.Use(middlewares.ErrorHandler)
+	report, err := db.IndexReport(db.Session.DB(db.Mongo.Database))
+	if err != nil {
+		fmt.Printf("Can't list indexes, go error %v\n", err)
+		os.Exit(1)
+	}
 
-	// Statics
-	router.Static("/public", "./public")
+	missing := false
+	for _, status := range report {
+		fmt.Println(status)
+		missing = missing || status.State == db.IndexMissing
+	}
+	if missing {
+		os.Exit(1)
+	}
+}
 
-	// Routes
+// admin grants admin rights to the users with the given emails, who may then
+// edit and delete every article
+func admin(emails []string) {
+	if len(emails) == 0 {
+		fmt.Println("Usage: go-gin-mgo-demo admin <email>...")
+		os.Exit(2)
+	}
 
-	router.GET("/", func(c *gin.Context) {
-		c.Redirect(http.StatusMovedPermanently, "/articles")
-	})
+	var users models.UserStore
+	if db.Shared != nil {
+		_, users = db.Shared.Stores()
+	} else {
+		users = db.NewMongoUsers(db.Session.DB(db.Mongo.Database))
+	}
+	for _, email := range emails {
+		err := users.SetAdmin(email, true)
+		if err != nil {
+			fmt.Printf("Can't make %s an admin, go error %v\n", email, err)
+			os.Exit(1)
+		}
+		fmt.Println(email, "is an admin")
+	}
+	if err := db.Close(); err != nil {
+		fmt.Printf("Can't save the users, go error %v\n", err)
+		os.Exit(1)
+	}
+}
 
-	// Articles
-	router.GET("/new", articles.New)
-	router.GET("/articles/:_id", articles.Edit)
-	router.GET("/articles", articles.List)
-	router.POST("/articles", articles.Create)
-	router.POST("/articles/:_id", articles.Update)
-	router.POST("/delete/articles/:_id", articles.Delete)
+// printConfig prints the configuration the server would start with, without
+// secrets
+func printConfig(cfg *config.Config, args []string) {
+	if len(args) != 1 || args[0] != "print" {
+		fmt.Println("Usage: go-gin-mgo-demo config print")
+		os.Exit(2)
+	}
 
-	// Start listening
-	port := Port
-	if len(os.Getenv("PORT")) > 0 {
-		port = os.Getenv("PORT")
+	out, err := json.MarshalIndent(cfg.Redacted(), "", "  ")
+	if err != nil {
+		fmt.Printf("Can't print the configuration, go error %v\n", err)
+		os.Exit(1)
 	}
-	router.Run(":" + port)
+	fmt.Println(string(out))
 }
@@ -0,0 +1,199 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+const (
+	// SessionCookie is the name of the cookie holding the signed session
+	SessionCookie = "session"
+	// SessionMaxAge is how long a session lasts after logging in
+	SessionMaxAge = 30 * 24 * time.Hour
+)
+
+var (
+	// SessionSecret is the key sessions are signed with. It defaults to a
+	// random key, which logs everybody out whenever the server restarts.
+	SessionSecret []byte
+
+	// ErrUnauthorized is the error reported for requests that need a user
+	// but are not logged in
+	ErrUnauthorized = errors.New("you need to log in")
+
+	// ErrForbidden is the error handlers report when the user may not access
+	// a document
+	ErrForbidden = errors.New("you are not allowed to do this")
+)
+
+func init() {
+	SessionSecret = make([]byte, 32)
+	if _, err := rand.Read(SessionSecret); err != nil {
+		panic(err.Error())
+	}
+}
+
+// Auth middleware loads the logged in user from the session cookie and makes
+// the `user` object available for each handler. It must come after Connect
+// or Stores.
+func Auth(c *gin.Context) {
+	users := c.MustGet("users").(models.UserStore)
+
+	var user *models.User
+	var err error
+	if id, ok := readSession(c); ok {
+		user, err = found(users.Get(id))
+	}
+	setUser(c, user, err)
+}
+
+// BasicAuth middleware loads the user from the Authorization header of API
+// clients using HTTP basic auth, replacing the user of the session, and has
+// RequireUser challenge clients for it. Use it on the API only: browsers
+// cache basic auth credentials and send them on cross-site requests, which
+// SameSite cookies are meant to prevent. It must come after Auth.
+// Usage: api.Use(middlewares.BasicAuth)
+func BasicAuth(c *gin.Context) {
+	c.Set("basicAuth", true)
+
+	email, password, ok := c.Request.BasicAuth()
+	if !ok {
+		c.Next()
+		return
+	}
+
+	users := c.MustGet("users").(models.UserStore)
+	user, err := found(users.GetByEmail(email))
+	if user != nil && !user.CheckPassword(password) {
+		user = nil
+	}
+	delete(c.Keys, "user")
+	setUser(c, user, err)
+}
+
+// setUser makes the user available for the next handlers, or aborts with the
+// error of looking them up
+func setUser(c *gin.Context, user *models.User, err error) {
+	if err != nil {
+		c.Error(err)
+		c.Abort()
+		return
+	}
+	if user != nil {
+		c.Set("user", user)
+	}
+	c.Next()
+}
+
+// RequireUser middleware aborts requests that are not logged in. Browsers
+// are redirected to the login page, other clients get a 401, which
+// challenges them for basic auth where BasicAuth accepts it.
+// Usage: router.GET("/new", middlewares.RequireUser, articles.New)
+func RequireUser(c *gin.Context) {
+	if CurrentUser(c) != nil {
+		c.Next()
+		return
+	}
+
+	if errorFormat(c) == binding.MIMEHTML {
+		location := Path(c, "/login")
+		if c.Request.Method == "GET" {
+			location += "?next=" + url.QueryEscape(c.Request.URL.RequestURI())
+		}
+		c.Redirect(http.StatusFound, location)
+		c.Abort()
+		return
+	}
+	if _, ok := c.Get("basicAuth"); ok {
+		c.Header("WWW-Authenticate", `Basic realm="articles"`)
+	}
+	c.AbortWithError(http.StatusUnauthorized, ErrUnauthorized)
+}
+
+// CurrentUser returns the logged in user or nil
+func CurrentUser(c *gin.Context) *models.User {
+	if user, ok := c.Get("user"); ok {
+		return user.(*models.User)
+	}
+	return nil
+}
+
+// Login starts a session for the user by setting the session cookie
+func Login(c *gin.Context, user *models.User) {
+	expires := time.Now().Add(SessionMaxAge)
+	value := user.Id.Hex() + "|" + strconv.FormatInt(expires.Unix(), 10)
+	setSessionCookie(c, value+"|"+sign(value), int(SessionMaxAge/time.Second))
+}
+
+// Logout ends the session by clearing the session cookie
+func Logout(c *gin.Context) {
+	setSessionCookie(c, "", -1)
+}
+
+// readSession returns the user id of a valid, unexpired session cookie
+func readSession(c *gin.Context) (bson.ObjectId, bool) {
+	cookie, err := c.Request.Cookie(SessionCookie)
+	if err != nil {
+		return "", false
+	}
+
+	parts := strings.Split(cookie.Value, "|")
+	if len(parts) != 3 || !bson.IsObjectIdHex(parts[0]) {
+		return "", false
+	}
+	value := parts[0] + "|" + parts[1]
+	if !hmac.Equal([]byte(sign(value)), []byte(parts[2])) {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", false
+	}
+	return bson.ObjectIdHex(parts[0]), true
+}
+
+// sign returns the HMAC of the value keyed with SessionSecret
+func sign(value string) string {
+	mac := hmac.New(sha256.New, SessionSecret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// setSessionCookie sets the session cookie, which is only sent back over
+// https if the request came over https, directly or through a proxy
+func setSessionCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    value,
+		Path:     Path(c, "/"),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// found returns the user looked up in the store, or nil if there is none
+func found(user models.User, err error) (*models.User, error) {
+	if err == models.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,171 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopkg.in/bluesuncorp/validator.v5"
+	"gopkg.in/mgo.v2"
+
+	"github.com/gin-gonic/gin"
+	"github.com/madhums/go-gin-mgo-demo/db"
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+const (
+	// ErrorValidation is the code of errors caused by request data failing
+	// the binding rules of a model
+	ErrorValidation = "validation_failed"
+	// ErrorBadRequest is the code of errors caused by malformed requests
+	ErrorBadRequest = "bad_request"
+	// ErrorUnsupportedMediaType is the code of errors caused by request bodies
+	// sent in a format the handler does not accept
+	ErrorUnsupportedMediaType = "unsupported_media_type"
+	// ErrorInvalidId is the code of errors caused by malformed ObjectIds
+	ErrorInvalidId = "invalid_id"
+	// ErrorUnauthorized is the code of errors caused by requests that need a
+	// logged in user
+	ErrorUnauthorized = "unauthorized"
+	// ErrorForbidden is the code of errors caused by users accessing documents
+	// they are not allowed to
+	ErrorForbidden = "forbidden"
+	// ErrorNotFound is the code of errors caused by missing documents
+	ErrorNotFound = "not_found"
+	// ErrorMethodNotAllowed is the code of errors caused by requests to a path
+	// that has no route for their method
+	ErrorMethodNotAllowed = "method_not_allowed"
+	// ErrorConflict is the code of errors caused by editing an outdated version
+	// of a document
+	ErrorConflict = "conflict"
+	// ErrorUnavailable is the code of errors caused by an unreachable database
+	ErrorUnavailable = "db_unavailable"
+	// ErrorInternal is the code of every other error
+	ErrorInternal = "internal_error"
+)
+
+var (
+	// ErrInvalidObjectId is the error handlers report when a route parameter
+	// is not a valid ObjectId
+	ErrInvalidObjectId = errors.New("invalid ObjectId")
+)
+
+// HTTPError is the body of every error response. JSON responses wrap it in
+// an `error` key:
+//
+//	{"error": {"status": 404, "code": "not_found", "message": "not found"}}
+type HTTPError struct {
+	Status  int      `json:"status"`
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+}
+
+// Error implements the error interface
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+// Classify maps an error reported by a handler to the HTTPError that is sent
+// to the client
+func Classify(err error) *HTTPError {
+	bindErr := false
+	if ginErr, ok := err.(*gin.Error); ok {
+		bindErr = ginErr.IsType(gin.ErrorTypeBind)
+		err = ginErr.Err
+	}
+
+	switch e := err.(type) {
+	case *HTTPError:
+		return e
+	case *validator.StructErrors:
+		return &HTTPError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    ErrorValidation,
+			Message: "validation failed",
+			Details: validationDetails(e),
+		}
+	}
+
+	switch {
+	case bindErr:
+		return &HTTPError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorBadRequest,
+			Message: err.Error(),
+		}
+	case err == ErrInvalidObjectId:
+		return &HTTPError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorInvalidId,
+			Message: err.Error(),
+		}
+	case err == ErrUnauthorized:
+		return &HTTPError{
+			Status:  http.StatusUnauthorized,
+			Code:    ErrorUnauthorized,
+			Message: err.Error(),
+		}
+	case err == ErrForbidden:
+		return &HTTPError{
+			Status:  http.StatusForbidden,
+			Code:    ErrorForbidden,
+			Message: err.Error(),
+		}
+	case err == mgo.ErrNotFound:
+		return &HTTPError{
+			Status:  http.StatusNotFound,
+			Code:    ErrorNotFound,
+			Message: err.Error(),
+		}
+	case err == models.ErrConflict:
+		return &HTTPError{
+			Status:  http.StatusConflict,
+			Code:    ErrorConflict,
+			Message: err.Error(),
+		}
+	case isUnavailable(err):
+		return &HTTPError{
+			Status:  http.StatusServiceUnavailable,
+			Code:    ErrorUnavailable,
+			Message: "database unavailable",
+		}
+	}
+
+	message := http.StatusText(http.StatusInternalServerError)
+	if gin.IsDebugging() {
+		message = err.Error()
+	}
+	return &HTTPError{
+		Status:  http.StatusInternalServerError,
+		Code:    ErrorInternal,
+		Message: message,
+	}
+}
+
+// isUnavailable reports whether the error means the database could not be
+// reached
+func isUnavailable(err error) bool {
+	if err == io.EOF || err == db.ErrUnavailable {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	msg := err.Error()
+	return msg == "no reachable servers" || msg == "Closed explicitly"
+}
+
+// validationDetails returns one `field: tag` line for each failed field
+func validationDetails(err *validator.StructErrors) []string {
+	details := []string{}
+	for field, fe := range err.Flatten() {
+		details = append(details, fmt.Sprintf("%s: %s", strings.ToLower(field), fe.Tag))
+	}
+	sort.Strings(details)
+	return details
+}
@@ -0,0 +1,71 @@
+package middlewares
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/madhums/go-gin-mgo-demo/db"
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+func TestClassify(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	defer gin.SetMode(gin.DebugMode)
+
+	invalid := binding.Validator.ValidateStruct(&models.Article{})
+	teapot := &HTTPError{Status: http.StatusTeapot, Code: "teapot", Message: "short and stout"}
+
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    string
+		message string
+	}{
+		{"http error", teapot, 418, "teapot", "short and stout"},
+		{"validation", &gin.Error{Err: invalid, Type: gin.ErrorTypeBind}, 422, ErrorValidation, "validation failed"},
+		{"bind", &gin.Error{Err: errors.New("unexpected EOF"), Type: gin.ErrorTypeBind}, 400, ErrorBadRequest, "unexpected EOF"},
+		{"invalid id", &gin.Error{Err: ErrInvalidObjectId, Type: gin.ErrorTypePrivate}, 400, ErrorInvalidId, "invalid ObjectId"},
+		{"unauthorized", ErrUnauthorized, 401, ErrorUnauthorized, ErrUnauthorized.Error()},
+		{"forbidden", ErrForbidden, 403, ErrorForbidden, ErrForbidden.Error()},
+		{"not found", mgo.ErrNotFound, 404, ErrorNotFound, "not found"},
+		{"store not found", models.ErrNotFound, 404, ErrorNotFound, "not found"},
+		{"conflict", models.ErrConflict, 409, ErrorConflict, models.ErrConflict.Error()},
+		{"eof", io.EOF, 503, ErrorUnavailable, "database unavailable"},
+		{"not connected", db.ErrUnavailable, 503, ErrorUnavailable, "database unavailable"},
+		{"no servers", errors.New("no reachable servers"), 503, ErrorUnavailable, "database unavailable"},
+		{"internal", errors.New("secret details"), 500, ErrorInternal, "Internal Server Error"},
+	}
+	for _, tt := range tests {
+		got := Classify(tt.err)
+		if got.Status != tt.status || got.Code != tt.code || got.Message != tt.message {
+			t.Errorf("%s: got %d %s %q, want %d %s %q", tt.name, got.Status, got.Code, got.Message, tt.status, tt.code, tt.message)
+		}
+	}
+
+	if details := Classify(invalid).Details; len(details) != 2 || details[0] != "body: required" || details[1] != "title: required" {
+		t.Errorf("got validation details %q", details)
+	}
+}
+
+func TestErrorTemplate(t *testing.T) {
+	tests := map[int]string{
+		400: "400",
+		401: "400",
+		404: "404",
+		409: "400",
+		500: "500",
+		503: "500",
+	}
+	for status, want := range tests {
+		if got := errorTemplate(status); got != want {
+			t.Errorf("errorTemplate(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
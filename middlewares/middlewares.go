@@ -4,30 +4,210 @@ package middlewares
 
 import (
 	"net/http"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/madhums/go-gin-mgo-demo/db"
+	"github.com/madhums/go-gin-mgo-demo/models"
 )
 
 // Connect middleware clones the database session for each request and
-// makes the `db` object available for each handler
+// makes the `db` object as well as the `articles` and `users` stores backed
+// by it available for each handler. With a shared backend, like the
+// in-memory stores, only its stores are set. Requests are aborted with
+// db.ErrUnavailable while the database has not been reached. It must come
+// after ErrorHandler.
 func Connect(c *gin.Context) {
-	s := db.Session.Clone()
+	if db.Shared != nil {
+		Stores(db.Shared.Stores())(c)
+		return
+	}
+
+	s, err := db.Clone()
+	if err != nil {
+		c.AbortWithError(http.StatusServiceUnavailable, err)
+		return
+	}
 
 	defer s.Close()
 
-	c.Set("db", s.DB(db.Mongo.Database))
+	database := s.DB(db.Mongo.Database)
+	c.Set("db", database)
+	c.Set("articles", models.ArticleStore(db.NewMongoArticles(database)))
+	c.Set("users", models.UserStore(db.NewMongoUsers(database)))
 	c.Next()
 }
 
-// ErrorHandler is a middleware to handle errors encountered during requests
+// Session middleware replaces the session cloned by Connect with one tuned by
+// the options, e.g. to read from secondaries or to wait for a majority of the
+// servers to acknowledge writes. It does nothing without a mongo session, like
+// with the in-memory stores.
+// Usage: router.GET("/articles", middlewares.Session(db.SessionOptions{Mode: db.Eventual}), articles.List)
+func Session(options db.SessionOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("db"); !ok || options == (db.SessionOptions{}) {
+			c.Next()
+			return
+		}
+
+		s, err := db.CloneWith(options)
+		if err != nil {
+			c.AbortWithError(http.StatusServiceUnavailable, err)
+			return
+		}
+
+		defer s.Close()
+
+		database := s.DB(db.Mongo.Database)
+		c.Set("db", database)
+		c.Set("articles", models.ArticleStore(db.NewMongoArticles(database)))
+		c.Set("users", models.UserStore(db.NewMongoUsers(database)))
+		c.Next()
+	}
+}
+
+// Stores middleware makes the given `articles` and `users` stores available
+// for each handler. It replaces Connect for stores that do not need a
+// session per request, like the in-memory stores.
+// Usage: router.Use(middlewares.Stores(db.NewMemoryArticles(), db.NewMemoryUsers()))
+func Stores(articles models.ArticleStore, users models.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("articles", articles)
+		c.Set("users", users)
+		c.Next()
+	}
+}
+
+// ObjectId middleware validates that the route parameter is an ObjectId and
+// makes the parsed `bson.ObjectId` available for each handler under the name
+// of the parameter. Requests with a malformed id are aborted with
+// ErrInvalidObjectId.
+// Usage: router.GET("/articles/:_id", middlewares.ObjectId("_id"), articles.Edit)
+func ObjectId(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param(param)
+		if !bson.IsObjectIdHex(id) {
+			c.AbortWithError(http.StatusBadRequest, ErrInvalidObjectId)
+			return
+		}
+
+		c.Set(param, bson.ObjectIdHex(id))
+		c.Next()
+	}
+}
+
+// ErrorHandler is a middleware to handle errors encountered during requests.
+// The last error is classified with `Classify` and rendered as JSON, HTML or
+// plain text depending on the Accept header of the request.
 func ErrorHandler(c *gin.Context) {
 	c.Next()
 
-	// TODO: Handle it in a better way
-	if len(c.Errors) > 0 {
-		c.HTML(http.StatusBadRequest, "400", gin.H{
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+
+	httpErr := Classify(c.Errors.Last())
+
+	switch errorFormat(c) {
+	case binding.MIMEJSON:
+		c.JSON(httpErr.Status, gin.H{
+			"error": httpErr,
+		})
+	case binding.MIMEPlain:
+		c.String(httpErr.Status, "%d %s\n", httpErr.Status, httpErr.Message)
+	default:
+		HTML(c, httpErr.Status, errorTemplate(httpErr.Status), gin.H{
+			"title":  http.StatusText(httpErr.Status),
+			"error":  httpErr,
 			"errors": c.Errors,
 		})
 	}
 }
+
+// DefaultFormat middleware sets the format ErrorHandler responds with when
+// the Accept header does not prefer any, e.g. `*/*` sent by most http clients.
+// Usage: api.Use(middlewares.DefaultFormat(binding.MIMEJSON))
+func DefaultFormat(format string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("format", format)
+		c.Next()
+	}
+}
+
+// LoggerExcept middleware logs requests like gin.Logger, except for requests
+// to the given paths, e.g. health checks which would drown the others.
+// Usage: router.Use(middlewares.LoggerExcept("/healthz", "/readyz"))
+func LoggerExcept(paths ...string) gin.HandlerFunc {
+	logger := gin.Logger()
+	skip := map[string]bool{}
+	for _, path := range paths {
+		skip[path] = true
+	}
+	return func(c *gin.Context) {
+		if skip[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		logger(c)
+	}
+}
+
+// BasePath middleware sets the path the app is mounted at, e.g. `/blog`.
+// Handlers build the urls of the app with Path.
+// Usage: router.Use(middlewares.BasePath("/blog"))
+func BasePath(path string) gin.HandlerFunc {
+	path = strings.TrimSuffix(path, "/")
+	return func(c *gin.Context) {
+		c.Set("basePath", path)
+		c.Next()
+	}
+}
+
+// Path returns the url of the path of the app, prefixed with the base path
+func Path(c *gin.Context, path string) string {
+	if base, ok := c.Get("basePath"); ok {
+		return base.(string) + path
+	}
+	return path
+}
+
+// HTML renders the template with the data every page needs: the base path of
+// the app as `base` and the logged in user as `currentUser`
+func HTML(c *gin.Context, status int, name string, data gin.H) {
+	data["base"] = Path(c, "")
+	data["currentUser"] = CurrentUser(c)
+	c.HTML(status, name, data)
+}
+
+// errorFormat negotiates the format of the error response
+func errorFormat(c *gin.Context) string {
+	format := binding.MIMEHTML
+	if f, ok := c.Get("format"); ok {
+		format = f.(string)
+	}
+
+	accept := c.Request.Header.Get("Accept")
+	if len(accept) == 0 || accept == "*/*" {
+		return format
+	}
+
+	negotiated := c.NegotiateFormat(binding.MIMEHTML, binding.MIMEJSON, binding.MIMEPlain)
+	if len(negotiated) == 0 {
+		return format
+	}
+	return negotiated
+}
+
+// errorTemplate returns the name of the template that renders the status
+func errorTemplate(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return "404"
+	case http.StatusInternalServerError, http.StatusServiceUnavailable:
+		return "500"
+	}
+	return "400"
+}
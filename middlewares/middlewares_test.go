@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/madhums/go-gin-mgo-demo/db"
+)
+
+func TestConnectUnavailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler, Connect)
+	router.GET("/articles", func(c *gin.Context) {
+		t.Error("handler called without database")
+	})
+
+	r := httptest.NewRequest("GET", "/articles", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"code":"db_unavailable"`) {
+		t.Errorf("got body %s", w.Body)
+	}
+}
+
+func TestSessionWithoutMongo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler)
+	called := false
+	router.GET("/articles", Session(db.SessionOptions{Mode: db.Eventual}), func(c *gin.Context) {
+		called = true
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/articles", nil))
+
+	if !called || w.Code != http.StatusOK {
+		t.Errorf("got status %d and called %v, want the handler to be called", w.Code, called)
+	}
+}
@@ -1,18 +1,200 @@
 package models
 
-import "gopkg.in/mgo.v2/bson"
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
 
 const (
 	// CollectionArticle holds the name of the articles collection
 	CollectionArticle = "articles"
 )
 
+var (
+	// ErrConflict is returned when an article was changed by someone else
+	// since it was read
+	ErrConflict = errors.New("the article was changed by someone else")
+)
+
 // Article model
 type Article struct {
 	Id        bson.ObjectId `json:"_id,omitempty" bson:"_id,omitempty"`
 	Title     string        `json:"title" form:"title" binding:"required" bson:"title"`
 	Body      string        `json:"body" form:"body" binding:"required" bson:"body"`
-	CreatedOn int64         `json:"created_on" bson:"created_on"`
-	UpdatedOn int64         `json:"updated_on" bson:"updated_on"`
-	// User      bson.ObjectId `json:"user"`
+	CreatedOn time.Time     `json:"created_on" bson:"created_on"`
+	UpdatedOn time.Time     `json:"updated_on" bson:"updated_on"`
+	Version   int           `json:"version" form:"version" bson:"version"`
+	User      bson.ObjectId `json:"user,omitempty" form:"-" bson:"user,omitempty"`
+}
+
+// BeforeInsert gives a new article its own id and stamps its creation and
+// update times. Every path inserting articles must call it.
+func (a *Article) BeforeInsert() {
+	a.Id = bson.NewObjectId()
+	a.CreatedOn = now()
+	a.UpdatedOn = a.CreatedOn
+	a.Version = 1
+}
+
+// BeforeUpdate stamps the update time of a changed article. Every path
+// updating articles must call it.
+func (a *Article) BeforeUpdate() {
+	a.UpdatedOn = now()
+}
+
+// ChangesFrom returns the update document setting only the fields of the
+// article that differ from the stored article, so that fields unknown to the
+// model survive edits. It stamps the update time and increments the version
+// if anything changed and returns nil otherwise. The id, the author and the
+// creation time can not be changed.
+//
+// The article must carry the version of the stored article it is based on,
+// ErrConflict is returned otherwise. Apply the update document with
+// VersionSelector of the stored article to catch concurrent changes.
+func (a *Article) ChangesFrom(stored Article) (bson.M, error) {
+	if a.Version != stored.Version {
+		return nil, ErrConflict
+	}
+	a.Id = stored.Id
+	a.User = stored.User
+	a.CreatedOn = stored.CreatedOn
+	a.UpdatedOn = stored.UpdatedOn
+
+	before, err := toM(stored)
+	if err != nil {
+		return nil, err
+	}
+	after, err := toM(a)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := bson.M{}
+	for field, value := range after {
+		if !reflect.DeepEqual(before[field], value) {
+			changed[field] = value
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	a.BeforeUpdate()
+	a.Version++
+	changed["updated_on"] = a.UpdatedOn
+	return bson.M{
+		"$set": changed,
+		"$inc": bson.M{"version": 1},
+	}, nil
+}
+
+// VersionSelector returns the selector matching the article only as long as
+// it is stored at the same version. Articles written before versioning have
+// no version field and match version 0.
+func (a Article) VersionSelector() bson.M {
+	if a.Version == 0 {
+		return bson.M{"_id": a.Id, "version": bson.M{"$in": []interface{}{0, nil}}}
+	}
+	return bson.M{"_id": a.Id, "version": a.Version}
+}
+
+// SearchResult is an article matching a full-text search along with its
+// relevance
+type SearchResult struct {
+	Article `bson:",inline"`
+	Score   float64 `json:"score" bson:"score"`
+}
+
+func init() {
+	for _, index := range []mgo.Index{
+		// Lists sort by updated_on and page by the keyset of updated_on and _id
+		{Key: []string{"-updated_on", "-_id"}},
+		{Key: []string{"-created_on"}},
+		{Key: []string{"user"}},
+
+		// Searches run on title and body, matches in the title weigh more
+		{
+			Key:     []string{"$text:title", "$text:body"},
+			Weights: map[string]int{"title": 3, "body": 1},
+		},
+	} {
+		if err := RegisterIndex(CollectionArticle, index); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
+// MigrateTimestamps converts the created_on and updated_on fields stored as
+// milliseconds since the epoch by earlier versions to dates. It returns the
+// number of migrated articles.
+func MigrateTimestamps(db *mgo.Database) (int, error) {
+	numeric := []bson.M{}
+	for _, field := range []string{"created_on", "updated_on"} {
+		// double, 32-bit integer and 64-bit integer
+		for _, t := range []int{1, 16, 18} {
+			numeric = append(numeric, bson.M{field: bson.M{"$type": t}})
+		}
+	}
+
+	type legacy struct {
+		Id        bson.ObjectId `bson:"_id"`
+		CreatedOn interface{}   `bson:"created_on"`
+		UpdatedOn interface{}   `bson:"updated_on"`
+	}
+
+	migrated := 0
+	c := db.C(CollectionArticle)
+	iter := c.Find(bson.M{"$or": numeric}).Iter()
+	for doc := (legacy{}); iter.Next(&doc); doc = (legacy{}) {
+		err := c.UpdateId(doc.Id, bson.M{"$set": bson.M{
+			"created_on": fromMillis(doc.CreatedOn),
+			"updated_on": fromMillis(doc.UpdatedOn),
+		}})
+		if err != nil {
+			iter.Close()
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, iter.Close()
+}
+
+// fromMillis converts a timestamp in milliseconds since the epoch to a time.
+// Values that already are times are returned as is and missing or zero
+// values become the zero time.
+func fromMillis(v interface{}) time.Time {
+	var millis int64
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case int:
+		millis = int64(t)
+	case int64:
+		millis = t
+	case float64:
+		millis = int64(t)
+	}
+	if millis == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)).UTC()
+}
+
+// toM converts a document to a bson.M the way it is stored
+func toM(doc interface{}) (bson.M, error) {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	m := bson.M{}
+	return m, bson.Unmarshal(data, m)
+}
+
+// now returns the current time with the millisecond precision of BSON dates
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
 }
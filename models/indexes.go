@@ -0,0 +1,68 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+)
+
+// Index declares an index of a collection. Models register their indexes in
+// init() and the db package ensures them on startup.
+type Index struct {
+	Collection string
+	mgo.Index
+}
+
+var indexes []Index
+
+// RegisterIndex declares an index of the collection. It returns an error if
+// the key is empty or malformed.
+func RegisterIndex(collection string, index mgo.Index) error {
+	if len(index.Key) == 0 {
+		return fmt.Errorf("index of %s needs a key", collection)
+	}
+	if _, err := keyName(index.Key); err != nil {
+		return fmt.Errorf("index of %s: %v", collection, err)
+	}
+	indexes = append(indexes, Index{Collection: collection, Index: index})
+	return nil
+}
+
+// Indexes returns all registered indexes
+func Indexes() []Index {
+	return indexes
+}
+
+// IndexName returns the name of the index in the database: its Name if set,
+// or the name mongodb derives from its key
+func (i Index) IndexName() string {
+	if len(i.Name) > 0 {
+		return i.Name
+	}
+	name, _ := keyName(i.Key)
+	return name
+}
+
+// keyName returns the name mongodb gives to an index with the key, e.g.
+// `updated_on_-1__id_-1` or `title_text_body_text`
+func keyName(key []string) (string, error) {
+	parts := []string{}
+	for _, field := range key {
+		switch {
+		case strings.HasPrefix(field, "$"):
+			kind := strings.SplitN(field[1:], ":", 2)
+			if len(kind) != 2 || len(kind[0]) == 0 || len(kind[1]) == 0 {
+				return "", fmt.Errorf("key %q must be $kind:field", field)
+			}
+			parts = append(parts, kind[1]+"_"+kind[0])
+		case strings.HasPrefix(field, "@"):
+			parts = append(parts, field[1:]+"_2d")
+		case strings.HasPrefix(field, "-"):
+			parts = append(parts, field[1:]+"_-1")
+		default:
+			parts = append(parts, strings.TrimPrefix(field, "+")+"_1")
+		}
+	}
+	return strings.Join(parts, "_"), nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2"
+)
+
+func TestRegisterIndex(t *testing.T) {
+	registered := indexes
+	defer func() { indexes = registered }()
+
+	tests := []struct {
+		name  string
+		index mgo.Index
+		want  string
+		err   bool
+	}{
+		{"compound", mgo.Index{Key: []string{"-updated_on", "+_id"}}, "updated_on_-1__id_1", false},
+		{"text", mgo.Index{Key: []string{"$text:title", "$text:body"}}, "title_text_body_text", false},
+		{"geo", mgo.Index{Key: []string{"@loc"}}, "loc_2d", false},
+		{"named", mgo.Index{Key: []string{"email"}, Name: "by_email"}, "by_email", false},
+		{"no key", mgo.Index{}, "", true},
+		{"text without field", mgo.Index{Key: []string{"$text"}}, "", true},
+		{"text with empty field", mgo.Index{Key: []string{"$text:"}}, "", true},
+	}
+	for _, tt := range tests {
+		indexes = nil
+		err := RegisterIndex("test", tt.index)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			if len(indexes) != 0 {
+				t.Errorf("%s: got the invalid index registered", tt.name)
+			}
+			continue
+		}
+		if got := indexes[0].IndexName(); got != tt.want {
+			t.Errorf("%s: got name %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
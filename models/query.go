@@ -0,0 +1,245 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// DefaultLimit is the number of articles listed per page when no limit is
+	// requested
+	DefaultLimit = 20
+	// MaxLimit is the maximum number of articles listed per page
+	MaxLimit = 100
+	// MaxPage is the last page that can be requested, so that skipping to it
+	// stays cheap and can't overflow. Deeper pages are reached by cursor.
+	MaxPage = 10000
+	// DefaultSort is the order in which articles are listed when no sort is
+	// requested
+	DefaultSort = "-updated_on"
+)
+
+var (
+	// SortFields holds the fields articles can be sorted by
+	SortFields = []string{"updated_on", "created_on", "title"}
+
+	// ErrInvalidCursor is returned for cursors that can not be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// ArticleQuery describes which articles to list and in which order. Articles
+// are paginated either by Page or, when a Cursor is set, by the keyset of
+// updated_on and _id.
+type ArticleQuery struct {
+	Page   int
+	Limit  int
+	Sort   string
+	From   time.Time
+	To     time.Time
+	Cursor *Cursor
+}
+
+// Cursor points at the last article of a page and is used to fetch the
+// articles following it
+type Cursor struct {
+	UpdatedOn time.Time
+	Id        bson.ObjectId
+}
+
+// NewArticleQuery returns a query for the first page in the default order
+func NewArticleQuery() ArticleQuery {
+	return ArticleQuery{
+		Page:  1,
+		Limit: DefaultLimit,
+		Sort:  DefaultSort,
+	}
+}
+
+// Validate checks the query and fills in the defaults
+func (q *ArticleQuery) Validate() error {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.Page > MaxPage {
+		return fmt.Errorf("page must not be above %d, use the cursor", MaxPage)
+	}
+	if q.Limit < 1 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+	if len(q.Sort) == 0 {
+		q.Sort = DefaultSort
+	}
+
+	field := q.SortField()
+	valid := false
+	for _, f := range SortFields {
+		if f == field {
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("can not sort by %q", field)
+	}
+
+	if q.Cursor != nil && field != "updated_on" {
+		return errors.New("cursors can only be used when sorting by updated_on")
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return errors.New("to must not be before from")
+	}
+	return nil
+}
+
+// SortField returns the field the query sorts by, without direction
+func (q ArticleQuery) SortField() string {
+	return strings.TrimPrefix(strings.TrimPrefix(q.Sort, "-"), "+")
+}
+
+// Descending reports whether the query sorts in descending order
+func (q ArticleQuery) Descending() bool {
+	return strings.HasPrefix(q.Sort, "-")
+}
+
+// Selector returns the mongo selector matching the articles of the query
+func (q ArticleQuery) Selector() bson.M {
+	and := []bson.M{}
+
+	updatedOn := bson.M{}
+	if !q.From.IsZero() {
+		updatedOn["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		updatedOn["$lt"] = q.To
+	}
+	if len(updatedOn) > 0 {
+		and = append(and, bson.M{"updated_on": updatedOn})
+	}
+
+	if q.Cursor != nil {
+		op := "$gt"
+		if q.Descending() {
+			op = "$lt"
+		}
+		and = append(and, bson.M{"$or": []bson.M{
+			{"updated_on": bson.M{op: q.Cursor.UpdatedOn}},
+			{"updated_on": q.Cursor.UpdatedOn, "_id": bson.M{op: q.Cursor.Id}},
+		}})
+	}
+
+	switch len(and) {
+	case 0:
+		return nil
+	case 1:
+		return and[0]
+	}
+	return bson.M{"$and": and}
+}
+
+// Match reports whether the article matches the filters and the cursor of
+// the query. It is the in-process equivalent of Selector.
+func (q ArticleQuery) Match(a Article) bool {
+	if !q.From.IsZero() && a.UpdatedOn.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !a.UpdatedOn.Before(q.To) {
+		return false
+	}
+	if q.Cursor != nil {
+		cursor := Article{Id: q.Cursor.Id, UpdatedOn: q.Cursor.UpdatedOn}
+		return q.Less(cursor, a)
+	}
+	return true
+}
+
+// Less reports whether article a is listed before article b. It is the
+// in-process equivalent of SortFields.
+func (q ArticleQuery) Less(a, b Article) bool {
+	cmp := 0
+	switch q.SortField() {
+	case "updated_on":
+		cmp = compareTimes(a.UpdatedOn, b.UpdatedOn)
+	case "created_on":
+		cmp = compareTimes(a.CreatedOn, b.CreatedOn)
+	case "title":
+		cmp = strings.Compare(a.Title, b.Title)
+	}
+	if cmp == 0 {
+		cmp = strings.Compare(string(a.Id), string(b.Id))
+	}
+	if q.Descending() {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+// SortFields returns the fields passed to mgo's Query.Sort. _id breaks ties
+// so that the order is stable.
+func (q ArticleQuery) SortFields() []string {
+	if q.Descending() {
+		return []string{q.Sort, "-_id"}
+	}
+	return []string{q.Sort, "_id"}
+}
+
+// Skip returns the number of articles to skip for the page of the query
+func (q ArticleQuery) Skip() int {
+	if q.Cursor != nil {
+		return 0
+	}
+	return (q.Page - 1) * q.Limit
+}
+
+// NewCursor returns the cursor pointing at the article
+func NewCursor(article Article) *Cursor {
+	return &Cursor{
+		UpdatedOn: article.UpdatedOn,
+		Id:        article.Id,
+	}
+}
+
+// String encodes the cursor to be passed around in urls
+func (c *Cursor) String() string {
+	raw := strconv.FormatInt(c.UpdatedOn.UnixNano()/int64(time.Millisecond), 10) + ":" + c.Id.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a cursor encoded with Cursor.String
+func ParseCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 || !bson.IsObjectIdHex(parts[1]) {
+		return nil, ErrInvalidCursor
+	}
+	millis, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{
+		UpdatedOn: time.Unix(0, millis*int64(time.Millisecond)).UTC(),
+		Id:        bson.ObjectIdHex(parts[1]),
+	}, nil
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
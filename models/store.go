@@ -0,0 +1,65 @@
+package models
+
+import (
+	"errors"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	// ErrNotFound is returned by stores for missing documents. It is the same
+	// error mgo returns so that it is handled alike for every store.
+	ErrNotFound = mgo.ErrNotFound
+
+	// ErrEmailTaken is returned when registering an email that already has an
+	// account
+	ErrEmailTaken = errors.New("an account with this email already exists")
+)
+
+// ArticleStore persists articles. Handlers get the store of the request with
+// c.MustGet("articles").(models.ArticleStore).
+type ArticleStore interface {
+	// Get returns the article with the id or ErrNotFound
+	Get(id bson.ObjectId) (Article, error)
+
+	// List returns the page of articles of the query and whether more
+	// articles follow it
+	List(q ArticleQuery) ([]Article, bool, error)
+
+	// Count returns the number of articles matching the query, ignoring its
+	// page and cursor
+	Count(q ArticleQuery) (int, error)
+
+	// Search returns the page of articles matching the text, most relevant
+	// first, along with the total number of matches
+	Search(text string, q ArticleQuery) ([]SearchResult, int, error)
+
+	// Create stamps and inserts a new article, or returns ErrConflict if an
+	// article with its id exists
+	Create(article *Article) error
+
+	// Update applies the changes of the article to the stored article, as
+	// long as it was not changed in the meantime. On conflict it returns the
+	// current article along with ErrConflict.
+	Update(stored Article, article *Article) (*Article, error)
+
+	// Delete removes the article with the id or returns ErrNotFound
+	Delete(id bson.ObjectId) error
+}
+
+// UserStore persists users. Handlers get the store of the request with
+// c.MustGet("users").(models.UserStore).
+type UserStore interface {
+	// Get returns the user with the id or ErrNotFound
+	Get(id bson.ObjectId) (User, error)
+
+	// GetByEmail returns the user with the email or ErrNotFound
+	GetByEmail(email string) (User, error)
+
+	// Create stamps and inserts a new user or returns ErrEmailTaken
+	Create(user *User) error
+
+	// SetAdmin grants or revokes the admin rights of the user with the email
+	SetAdmin(email string, admin bool) error
+}
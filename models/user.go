@@ -0,0 +1,104 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// CollectionUser holds the name of the users collection
+	CollectionUser = "users"
+)
+
+// ErrPasswordTooLong is returned for passwords longer than the 72 bytes bcrypt
+// hashes. Registration limits passwords to 72 characters, which may be more
+// bytes.
+var ErrPasswordTooLong = bcrypt.ErrPasswordTooLong
+
+// User model. The database stores the bcrypt hash of Password.
+type User struct {
+	Id           bson.ObjectId `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name         string        `json:"name" bson:"name"`
+	Email        string        `json:"email" bson:"email"`
+	Password     string        `json:"-" bson:"-"`
+	PasswordHash []byte        `json:"-" bson:"password_hash"`
+	Admin        bool          `json:"admin" bson:"admin"`
+	CreatedOn    time.Time     `json:"created_on" bson:"created_on"`
+}
+
+// Registration are the fields of the registration form. Users are never
+// bound directly, so that clients can't set their id or admin rights.
+type Registration struct {
+	Name     string `json:"name" form:"name" binding:"required"`
+	Email    string `json:"email" form:"email" binding:"required,email"`
+	Password string `json:"password" form:"password" binding:"required,min=8,max=72"`
+}
+
+// User returns a new user, who is not an admin, with the registered fields
+func (r Registration) User() User {
+	return User{
+		Id:       bson.NewObjectId(),
+		Name:     r.Name,
+		Email:    r.Email,
+		Password: r.Password,
+		Admin:    false,
+	}
+}
+
+// Credentials are the fields of the login form
+type Credentials struct {
+	Email    string `form:"email" binding:"required"`
+	Password string `form:"password" binding:"required"`
+}
+
+// BeforeInsert normalizes the email, hashes the password and stamps the
+// creation time of a new user. Every path inserting users must call it.
+func (u *User) BeforeInsert() error {
+	if len(u.Id) == 0 {
+		u.Id = bson.NewObjectId()
+	}
+	u.Email = NormalizeEmail(u.Email)
+	u.CreatedOn = now()
+	return u.SetPassword(u.Password)
+}
+
+// SetPassword replaces the password hash of the user
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.Password = ""
+	u.PasswordHash = hash
+	return nil
+}
+
+// CheckPassword reports whether the password matches the hash of the user
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) == nil
+}
+
+// NormalizeEmail returns the email in the form it is stored and looked up in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// CanEdit reports whether the user may edit or delete the article: authors
+// may edit their own articles and admins every article
+func (u *User) CanEdit(article Article) bool {
+	if u == nil {
+		return false
+	}
+	return u.Admin || (len(article.User) > 0 && article.User == u.Id)
+}
+
+func init() {
+	// Users log in by email
+	if err := RegisterIndex(CollectionUser, mgo.Index{Key: []string{"email"}, Unique: true}); err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,290 @@
+// Package server builds the http.Handler of the articles app so that it can
+// be run on its own or mounted in another service.
+//
+// Usage
+//
+//	err := db.Connect(db.Options{URL: db.MongoDBUrl, Timeout: 10 * time.Second})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer db.Close()
+//	http.Handle("/blog/", server.NewServer(server.Config{BasePath: "/blog"}))
+package server
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/madhums/go-gin-mgo-demo/db"
+	"github.com/madhums/go-gin-mgo-demo/gin_html_render"
+	"github.com/madhums/go-gin-mgo-demo/handlers/articles"
+	"github.com/madhums/go-gin-mgo-demo/handlers/health"
+	"github.com/madhums/go-gin-mgo-demo/handlers/users"
+	"github.com/madhums/go-gin-mgo-demo/middlewares"
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+const (
+	// TemplatesDir is the default directory of the templates
+	TemplatesDir = "templates/"
+	// PublicDir is the default directory of the static files
+	PublicDir = "./public"
+	// Layout is the default layout of the pages
+	Layout = "layouts/default"
+)
+
+// Config holds the options of the server
+type Config struct {
+	// BasePath is the path the app is mounted at, e.g. `/blog`. Requests
+	// must reach the handler with the full path, don't strip the prefix.
+	BasePath string
+
+	// TemplatesDir and PublicDir default to the directories of this repo
+	TemplatesDir string
+	PublicDir    string
+
+	// FS holds the templates and the static files instead of the disk, e.g.
+	// the embed.FS of the binary. TemplatesDir and PublicDir are then their
+	// paths in it, dirs it does not hold are read from disk. In debug mode
+	// they are read from disk if they exist there.
+	FS fs.FS
+
+	// Layout every page is rendered in and file extension of the templates,
+	// they default to "layouts/default" and ".html"
+	Layout string
+	Ext    string
+
+	// Debug reloads the templates on every request
+	Debug bool
+
+	// ReadSession tunes the mongo session of the routes listing and searching
+	// articles, e.g. db.SessionOptions{Mode: db.Eventual} to read them from
+	// secondaries
+	ReadSession db.SessionOptions
+
+	// Articles and Users replace the stores of the database opened by
+	// db.Connect if both are set
+	Articles models.ArticleStore
+	Users    models.UserStore
+}
+
+// NewServer returns the handler serving the pages, the JSON API and the
+// static files of the app
+func NewServer(config Config) http.Handler {
+	if len(config.TemplatesDir) == 0 {
+		config.TemplatesDir = TemplatesDir
+	}
+	if len(config.PublicDir) == 0 {
+		config.PublicDir = PublicDir
+	}
+	if len(config.Layout) == 0 {
+		config.Layout = Layout
+	}
+	if len(config.Ext) == 0 {
+		config.Ext = GinHTMLRender.Ext
+	}
+
+	router := gin.New()
+
+	// Set html render options
+	htmlRender := GinHTMLRender.New()
+	htmlRender.Debug = config.Debug
+	htmlRender.Layout = config.Layout
+	htmlRender.TemplatesDir = config.TemplatesDir
+	htmlRender.Ext = config.Ext
+	htmlRender.FS = config.FS
+	htmlRender.DiskFallback = true
+
+	// Tell gin to use our html render
+	templates := htmlRender.Create()
+	router.HTMLRender = templates
+
+	router.RedirectTrailingSlash = true
+	router.RedirectFixedPath = true
+
+	// Middlewares
+	healthz := config.BasePath + "/healthz"
+	readyz := config.BasePath + "/readyz"
+	router.Use(middlewares.LoggerExcept(healthz, readyz))
+	router.Use(gin.Recovery())
+	router.Use(middlewares.BasePath(config.BasePath))
+	router.Use(middlewares.ErrorHandler)
+
+	// Health checks, registered before the database middlewares so that they
+	// answer while the database is down
+	router.GET(healthz, health.Live)
+	router.GET(readyz, health.Ready(
+		health.Check{Name: "database", Run: db.Ping},
+		health.Check{Name: "templates", Run: templates.Check},
+	))
+
+	if config.Articles != nil && config.Users != nil {
+		router.Use(middlewares.Stores(config.Articles, config.Users))
+	} else {
+		router.Use(middlewares.Connect)
+	}
+	router.Use(middlewares.Auth)
+
+	app := router.Group(config.BasePath)
+
+	// named records the path of a route for `urlFor` in templates
+	named := func(name, path string) string {
+		templates.Routes[name] = config.BasePath + path
+		return path
+	}
+
+	// Statics
+	app.StaticFS("/public", public(config))
+	named("public", "/public/*filepath")
+
+	// Routes
+
+	app.GET("/", func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, middlewares.Path(c, "/articles"))
+	})
+
+	// Users
+	app.GET(named("register", "/register"), users.New)
+	app.POST("/register", users.Create)
+	app.GET(named("login", "/login"), users.LoginForm)
+	app.POST("/login", users.Login)
+	app.POST(named("logout", "/logout"), users.Logout)
+
+	// Articles
+	objectId := middlewares.ObjectId("_id")
+	requireUser := middlewares.RequireUser
+	read := middlewares.Session(config.ReadSession)
+	app.GET(named("new", "/new"), requireUser, articles.New)
+	app.GET(named("article", "/articles/:_id"), objectId, articles.Edit)
+	app.GET(named("articles", "/articles"), read, articles.List)
+	app.GET(named("search", "/search"), read, articles.Search)
+	app.POST("/articles", requireUser, articles.Create)
+	app.POST("/articles/:_id", requireUser, objectId, articles.Update)
+	app.POST(named("delete", "/delete/articles/:_id"), requireUser, objectId, articles.Delete)
+
+	// JSON API
+	api := app.Group("/api/v1")
+	api.Use(middlewares.DefaultFormat(binding.MIMEJSON), middlewares.BasicAuth)
+	{
+		api.GET("/articles", read, articles.APIList)
+		api.POST("/articles", requireUser, articles.APICreate)
+		api.GET("/search", read, articles.APISearch)
+		api.GET("/articles/:_id", objectId, articles.APIGet)
+		api.PUT("/articles/:_id", requireUser, objectId, articles.APIUpdate)
+		api.PATCH("/articles/:_id", requireUser, objectId, articles.APIPatch)
+		api.DELETE("/articles/:_id", requireUser, objectId, articles.APIDelete)
+	}
+
+	// Unknown routes are reported to ErrorHandler like every other error
+	router.HandleMethodNotAllowed = true
+	unknown := noRoute(router, config.BasePath+"/api/")
+	router.NoRoute(unknown)
+	router.NoMethod(unknown)
+
+	return router
+}
+
+// noRoute returns the handler of requests no route matches, which responds
+// with 405 and the Allow header if the path has routes for other methods and
+// with 404 otherwise. Paths under api respond in JSON.
+func noRoute(router *gin.Engine, api string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, api) {
+			c.Set("format", binding.MIMEJSON)
+		}
+
+		methods := allowed(router.Routes(), c.Request.URL.Path)
+		if len(methods) == 0 {
+			c.Error(models.ErrNotFound)
+			return
+		}
+		c.Header("Allow", strings.Join(methods, ", "))
+		c.Error(&middlewares.HTTPError{
+			Status:  http.StatusMethodNotAllowed,
+			Code:    middlewares.ErrorMethodNotAllowed,
+			Message: "method not allowed",
+		})
+	}
+}
+
+// allowed returns the sorted methods of the routes matching the path
+func allowed(routes gin.RoutesInfo, path string) []string {
+	methods := []string{}
+	for _, route := range routes {
+		if matches(route.Path, path) {
+			methods = append(methods, route.Method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// matches reports whether the path matches the route, where `:name` matches
+// one segment and `*name` the rest of the path
+func matches(route, path string) bool {
+	routeSegments, pathSegments := strings.Split(route, "/"), strings.Split(path, "/")
+	for i, segment := range routeSegments {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+		if i == len(pathSegments) {
+			return false
+		}
+		if segment != pathSegments[i] && !(strings.HasPrefix(segment, ":") && len(pathSegments[i]) > 0) {
+			return false
+		}
+	}
+	return len(routeSegments) == len(pathSegments)
+}
+
+// public returns the file system of the static files, which does not list
+// directories. They are read from disk if FS does not hold PublicDir.
+func public(config Config) http.FileSystem {
+	if config.FS == nil {
+		return gin.Dir(config.PublicDir, false)
+	}
+	if config.Debug {
+		if _, err := os.Stat(config.PublicDir); err == nil {
+			return gin.Dir(config.PublicDir, false)
+		}
+	}
+
+	name := path.Clean(config.PublicDir)
+	if info, err := fs.Stat(config.FS, name); err == nil && info.IsDir() {
+		if dir, err := fs.Sub(config.FS, name); err == nil {
+			return onlyFiles{http.FS(dir)}
+		}
+	}
+	return gin.Dir(config.PublicDir, false)
+}
+
+// onlyFiles is a http.FileSystem that does not list directories, like
+// gin.Dir
+type onlyFiles struct {
+	http.FileSystem
+}
+
+// Open implements http.FileSystem
+func (o onlyFiles) Open(name string) (http.File, error) {
+	f, err := o.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return noReaddir{f}, nil
+}
+
+// noReaddir is a http.File whose directory listing is empty
+type noReaddir struct {
+	http.File
+}
+
+// Readdir implements http.File
+func (noReaddir) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, nil
+}
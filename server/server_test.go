@@ -0,0 +1,522 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/gin-gonic/gin"
+	"github.com/madhums/go-gin-mgo-demo/db"
+	"github.com/madhums/go-gin-mgo-demo/models"
+)
+
+const password = "secret123"
+
+var router http.Handler
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	router = NewServer(Config{TemplatesDir: "../templates/", PublicDir: "../public"})
+	os.Exit(m.Run())
+}
+
+// fixture holds the stores of a test along with a few users and articles
+type fixture struct {
+	articles models.ArticleStore
+	users    models.UserStore
+
+	author  models.User
+	other   models.User
+	admin   models.User
+	article models.Article
+
+	cookies map[bson.ObjectId]*http.Cookie
+}
+
+// setup replaces the stores with empty in-memory stores holding an article
+// of the author
+func setup(t *testing.T) *fixture {
+	backend, err := db.OpenMemory("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Shared = backend
+
+	f := &fixture{cookies: map[bson.ObjectId]*http.Cookie{}}
+	f.articles, f.users = backend.Stores()
+	f.author = f.user(t, "author@example.com", false)
+	f.other = f.user(t, "other@example.com", false)
+	f.admin = f.user(t, "admin@example.com", true)
+
+	f.article = models.Article{Title: "Hello", Body: "Hello world", User: f.author.Id}
+	if err := f.articles.Create(&f.article); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// user creates a user and logs them in
+func (f *fixture) user(t *testing.T, email string, admin bool) models.User {
+	user := models.User{Name: email, Email: email, Password: password}
+	if err := f.users.Create(&user); err != nil {
+		t.Fatal(err)
+	}
+	if admin {
+		if err := f.users.SetAdmin(email, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	form := url.Values{"email": {email}, "password": {password}}
+	w := serve(request("POST", "/login", form.Encode(), "application/x-www-form-urlencoded"))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login of %s: got status %d", email, w.Code)
+	}
+	f.cookies[user.Id] = readCookie(w)
+	return user
+}
+
+// as returns the request sent by the user, or anonymously for nil
+func (f *fixture) as(user *models.User, r *http.Request) *http.Request {
+	if user != nil {
+		r.AddCookie(f.cookies[user.Id])
+	}
+	return r
+}
+
+// routeTest is a request along with the expected response
+type routeTest struct {
+	name     string
+	method   string
+	path     string
+	body     string
+	header   map[string]string
+	user     *models.User
+	status   int
+	location string
+	contains string
+}
+
+func (tt routeTest) run(t *testing.T, f *fixture) *httptest.ResponseRecorder {
+	contentType := ""
+	if strings.HasPrefix(tt.path, "/api/") {
+		contentType = "application/json"
+	} else if len(tt.body) > 0 {
+		contentType = "application/x-www-form-urlencoded"
+	}
+	r := f.as(tt.user, request(tt.method, tt.path, tt.body, contentType))
+	for key, value := range tt.header {
+		r.Header.Set(key, value)
+	}
+
+	w := serve(r)
+	if w.Code != tt.status {
+		t.Errorf("%s: got status %d, want %d\n%s", tt.name, w.Code, tt.status, w.Body)
+	}
+	if len(tt.location) > 0 && w.Header().Get("Location") != tt.location {
+		t.Errorf("%s: got location %q, want %q", tt.name, w.Header().Get("Location"), tt.location)
+	}
+	if !strings.Contains(w.Body.String(), tt.contains) {
+		t.Errorf("%s: body does not contain %q\n%s", tt.name, tt.contains, w.Body)
+	}
+	return w
+}
+
+func TestPages(t *testing.T) {
+	f := setup(t)
+	id := f.article.Id.Hex()
+	missing := bson.NewObjectId().Hex()
+
+	tests := []routeTest{
+		{name: "home", method: "GET", path: "/", status: 301, location: "/articles"},
+		{name: "list", method: "GET", path: "/articles", status: 200, contains: "Hello"},
+		{name: "list sorted", method: "GET", path: "/articles?sort=title", status: 200, contains: "Hello"},
+		{name: "list bad sort", method: "GET", path: "/articles?sort=body", status: 400, contains: "can not sort by"},
+		{name: "new anonymous", method: "GET", path: "/new", status: 302, location: "/login?next=%2Fnew"},
+		{name: "new", method: "GET", path: "/new", user: &f.author, status: 200, contains: "New article"},
+		{name: "edit", method: "GET", path: "/articles/" + id, user: &f.author, status: 200, contains: "Hello world"},
+		{name: "edit delete button", method: "GET", path: "/articles/" + id, user: &f.author, status: 200, contains: `onsubmit="return confirm(`},
+		{name: "edit read-only", method: "GET", path: "/articles/" + id, status: 200, contains: "Hello world"},
+		{name: "edit invalid id", method: "GET", path: "/articles/nope", status: 400, contains: "invalid ObjectId"},
+		{name: "edit missing", method: "GET", path: "/articles/" + missing, status: 404},
+		{name: "search", method: "GET", path: "/search?q=world", status: 200, contains: "<mark>world</mark>"},
+		{name: "search empty", method: "GET", path: "/search", status: 200},
+		{name: "unknown page", method: "GET", path: "/nope", status: 404, contains: "<title>Go gin mgo demo | Not Found</title>"},
+		{name: "create anonymous", method: "POST", path: "/articles", body: "title=New&body=Text", status: 302, location: "/login"},
+		{name: "create invalid", method: "POST", path: "/articles", body: "title=New", user: &f.author, status: 422, contains: "body: required"},
+		{name: "create", method: "POST", path: "/articles", body: "title=New&body=Text", user: &f.author, status: 301, location: "/articles"},
+		{name: "create with id", method: "POST", path: "/articles", body: "title=Mine&body=Text&Id=" + id, user: &f.other, status: 301, location: "/articles"},
+		{name: "create with invalid id", method: "POST", path: "/articles", body: "title=Mine&body=Text&Id=nope&-=nope", user: &f.other, status: 301, location: "/articles"},
+		{name: "edit after create with id", method: "GET", path: "/articles/" + id, status: 200, contains: "Hello world"},
+		{name: "update forbidden", method: "POST", path: "/articles/" + id, body: "title=Bye&body=Text&version=1", user: &f.other, status: 403},
+		{name: "update malformed version", method: "POST", path: "/articles/" + id, body: "title=Bye&body=Text&version=abc", user: &f.author, status: 400},
+		{name: "update", method: "POST", path: "/articles/" + id, body: "title=Bye&body=Text&version=1", user: &f.author, status: 301, location: "/articles"},
+		{name: "update conflict", method: "POST", path: "/articles/" + id, body: "title=Again&body=Text&version=1", user: &f.author, status: 409, contains: "Bye"},
+		{name: "update by admin", method: "POST", path: "/articles/" + id, body: "title=Admin&body=Text&version=2", user: &f.admin, status: 301},
+		{name: "delete forbidden", method: "POST", path: "/delete/articles/" + id, user: &f.other, status: 403},
+		{name: "delete", method: "POST", path: "/delete/articles/" + id, user: &f.author, status: 301, location: "/articles"},
+		{name: "delete missing", method: "POST", path: "/delete/articles/" + id, user: &f.author, status: 404},
+	}
+	for _, tt := range tests {
+		tt.run(t, f)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	f := setup(t)
+	id := f.article.Id.Hex()
+	missing := bson.NewObjectId().Hex()
+
+	tests := []routeTest{
+		{name: "list", method: "GET", path: "/api/v1/articles", status: 200, contains: `"total":1`},
+		{name: "list bad limit", method: "GET", path: "/api/v1/articles?limit=x", status: 400, contains: `"code":"bad_request"`},
+		{name: "list page out of range", method: "GET", path: "/api/v1/articles?page=922337203685477580&limit=100", status: 400, contains: "use the cursor"},
+		{name: "search page out of range", method: "GET", path: "/api/v1/search?q=hello&page=922337203685477580&limit=100", status: 400, contains: "use the cursor"},
+		{name: "unknown route", method: "GET", path: "/api/v1/nope", status: 404, contains: `"code":"not_found"`},
+		{name: "get", method: "GET", path: "/api/v1/articles/" + id, status: 200, contains: `"title":"Hello"`},
+		{name: "get invalid id", method: "GET", path: "/api/v1/articles/nope", status: 400, contains: `"code":"invalid_id"`},
+		{name: "get missing", method: "GET", path: "/api/v1/articles/" + missing, status: 404, contains: `"code":"not_found"`},
+		{name: "search", method: "GET", path: "/api/v1/search?q=hello", status: 200, contains: `"total":1`},
+		{name: "search without query", method: "GET", path: "/api/v1/search", status: 400, contains: "missing search query"},
+		{name: "create anonymous", method: "POST", path: "/api/v1/articles", body: `{"title":"New","body":"Text"}`, status: 401, contains: `"code":"unauthorized"`},
+		{name: "create malformed", method: "POST", path: "/api/v1/articles", body: `{"title":`, user: &f.author, status: 400},
+		{name: "create invalid", method: "POST", path: "/api/v1/articles", body: `{"title":"New"}`, user: &f.author, status: 422, contains: `"code":"validation_failed"`},
+		{name: "create", method: "POST", path: "/api/v1/articles", body: `{"title":"New","body":"Text"}`, user: &f.author, status: 201, contains: `"version":1`},
+		{name: "create with id", method: "POST", path: "/api/v1/articles", body: `{"_id":"` + id + `","title":"Mine","body":"Text","version":7}`, user: &f.other, status: 201, contains: `"version":1`},
+		{name: "get after create with id", method: "GET", path: "/api/v1/articles/" + id, status: 200, contains: `"title":"Hello"`},
+		{name: "update forbidden", method: "PUT", path: "/api/v1/articles/" + id, body: `{"title":"Bye","body":"Text"}`, user: &f.other, status: 403, contains: `"code":"forbidden"`},
+		{name: "update", method: "PUT", path: "/api/v1/articles/" + id, body: `{"title":"Bye","body":"Text"}`, header: map[string]string{"If-Match": `"1"`}, user: &f.author, status: 200, contains: `"version":2`},
+		{name: "update conflict", method: "PUT", path: "/api/v1/articles/" + id, body: `{"title":"Again","body":"Text"}`, header: map[string]string{"If-Match": `"1"`}, user: &f.author, status: 409, contains: `"code":"conflict"`},
+		{name: "update bad if-match", method: "PUT", path: "/api/v1/articles/" + id, body: `{"title":"Again","body":"Text"}`, header: map[string]string{"If-Match": "x"}, user: &f.author, status: 400},
+		{name: "update weak if-match", method: "PUT", path: "/api/v1/articles/" + id, body: `{"title":"Again","body":"Text"}`, header: map[string]string{"If-Match": `W/"2"`}, user: &f.author, status: 400, contains: "weak entity tag"},
+		{name: "update matching and weak if-match", method: "PUT", path: "/api/v1/articles/" + id, body: `{"title":"Again","body":"Text"}`, header: map[string]string{"If-Match": `"2", W/"2"`}, user: &f.author, status: 400, contains: "weak entity tag"},
+		{name: "update unquoted if-match", method: "PUT", path: "/api/v1/articles/" + id, body: `{"title":"Again","body":"Text"}`, header: map[string]string{"If-Match": "2"}, user: &f.author, status: 400},
+		{name: "patch unsupported", method: "PATCH", path: "/api/v1/articles/" + id, body: `{"title":"Patched"}`, header: map[string]string{"Content-Type": "text/plain"}, user: &f.author, status: 415, contains: `"code":"unsupported_media_type"`},
+		{name: "patch invalid", method: "PATCH", path: "/api/v1/articles/" + id, body: `{"title":null}`, header: map[string]string{"Content-Type": "application/merge-patch+json"}, user: &f.author, status: 422},
+		{name: "patch", method: "PATCH", path: "/api/v1/articles/" + id, body: `{"title":"Patched"}`, header: map[string]string{"Content-Type": "application/merge-patch+json"}, user: &f.author, status: 200, contains: `"body":"Text"`},
+		{name: "delete forbidden", method: "DELETE", path: "/api/v1/articles/" + id, user: &f.other, status: 403},
+		{name: "delete", method: "DELETE", path: "/api/v1/articles/" + id, user: &f.author, status: 204},
+		{name: "delete missing", method: "DELETE", path: "/api/v1/articles/" + id, user: &f.author, status: 404},
+	}
+	for _, tt := range tests {
+		tt.run(t, f)
+	}
+}
+
+func TestAPIHeaders(t *testing.T) {
+	f := setup(t)
+
+	w := routeTest{name: "get", method: "GET", path: "/api/v1/articles/" + f.article.Id.Hex(), status: 200}.run(t, f)
+	if etag := w.Header().Get("ETag"); etag != `"1"` {
+		t.Errorf("got ETag %q, want \"1\"", etag)
+	}
+
+	w = routeTest{name: "create", method: "POST", path: "/api/v1/articles", body: `{"title":"New","body":"Text"}`, user: &f.author, status: 201}.run(t, f)
+	created := models.Article{}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if location := w.Header().Get("Location"); location != "/api/v1/articles/"+created.Id.Hex() {
+		t.Errorf("got Location %q", location)
+	}
+	if created.User != f.author.Id {
+		t.Errorf("got author %s, want %s", created.User.Hex(), f.author.Id.Hex())
+	}
+
+	w = routeTest{name: "list", method: "GET", path: "/api/v1/articles?limit=1", status: 200}.run(t, f)
+	if link := w.Header().Get("Link"); !strings.Contains(link, `rel="next"`) {
+		t.Errorf("got Link %q, want a next link", link)
+	}
+
+	w = routeTest{name: "unknown method", method: "POST", path: "/api/v1/articles/" + f.article.Id.Hex(), status: 405, contains: `"code":"method_not_allowed"`}.run(t, f)
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, PATCH, PUT" {
+		t.Errorf("got Allow %q, want the methods of the article", allow)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	f := setup(t)
+
+	tests := []routeTest{
+		{name: "register form", method: "GET", path: "/register", status: 200},
+		{name: "register invalid", method: "POST", path: "/register", body: "name=A&email=nope&password=secret123", status: 422},
+		{name: "register malformed", method: "POST", path: "/register", body: "name=A&email=%zz", status: 400},
+		{name: "register long password", method: "POST", path: "/register", body: "name=A&email=long@example.com&password=" + strings.Repeat("a", 73), status: 422, contains: "password: max"},
+		{name: "register long password bytes", method: "POST", path: "/register", body: "name=A&email=long@example.com&password=" + strings.Repeat("%C3%A9", 40), status: 422, contains: "at most 72 bytes"},
+		{name: "register taken", method: "POST", path: "/register", body: "name=A&email=author@example.com&password=secret123", status: 422, contains: "already exists"},
+		{name: "register", method: "POST", path: "/register", body: "name=A&email=new@example.com&password=secret123", status: 302, location: "/articles"},
+		{name: "register dash field", method: "POST", path: "/register", body: "name=mal&email=mal@example.com&password=password1&-=1", status: 302, location: "/articles"},
+		{name: "login form", method: "GET", path: "/login", status: 200},
+		{name: "login wrong password", method: "POST", path: "/login", body: "email=author@example.com&password=wrong", status: 401, contains: "Wrong email or password"},
+		{name: "login next", method: "POST", path: "/login", body: "email=author@example.com&password=secret123&next=%2Fnew", status: 302, location: "/new"},
+		{name: "login foreign next", method: "POST", path: "/login", body: "email=author@example.com&password=secret123&next=%2F%2Fevil.com", status: 302, location: "/articles"},
+		{name: "logout", method: "POST", path: "/logout", user: &f.author, status: 302, location: "/articles"},
+	}
+	for _, tt := range tests {
+		tt.run(t, f)
+	}
+
+	mal, err := f.users.GetByEmail("mal@example.com")
+	if err != nil || mal.Admin || len(mal.PasswordHash) == 0 {
+		t.Errorf("got user %+v and error %v, want a user who is not an admin", mal, err)
+	}
+
+	w := serve(request("POST", "/register", `{"name":"J","email":"json@example.com","password":"secret123"}`, "application/json"))
+	if w.Code != http.StatusFound {
+		t.Errorf("register json: got status %d, want 302\n%s", w.Code, w.Body)
+	}
+
+	w = serve(request("POST", "/register", `{"name":`, "application/json"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("register malformed json: got status %d, want 400\n%s", w.Code, w.Body)
+	}
+
+	r := request("GET", "/api/v1/articles", "", "")
+	r.SetBasicAuth("author@example.com", password)
+	r.Method = "DELETE"
+	r.URL.Path += "/" + f.article.Id.Hex()
+	if w := serve(r); w.Code != http.StatusNoContent {
+		t.Errorf("basic auth: got status %d, want 204", w.Code)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	f := setup(t)
+	id := f.article.Id.Hex()
+	basic := map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("author@example.com:"+password))}
+	wrong := map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("author@example.com:wrong"))}
+
+	tests := []routeTest{
+		{name: "page ignores basic auth", method: "POST", path: "/articles", body: "title=New&body=Text", header: basic, status: 302, location: "/login"},
+		{name: "api basic auth", method: "POST", path: "/api/v1/articles", body: `{"title":"New","body":"Text"}`, header: basic, status: 201},
+		{name: "api wrong password", method: "POST", path: "/api/v1/articles", body: `{"title":"New","body":"Text"}`, header: wrong, user: &f.author, status: 401},
+		{name: "api session", method: "PATCH", path: "/api/v1/articles/" + id, body: `{"title":"Patched"}`, user: &f.author, status: 200},
+	}
+	for _, tt := range tests {
+		tt.run(t, f)
+	}
+
+	challenges := []struct {
+		test routeTest
+		want string
+	}{
+		{routeTest{name: "api challenge", method: "POST", path: "/api/v1/articles", body: `{"title":"New"}`, status: 401}, `Basic realm="articles"`},
+		{routeTest{name: "page no challenge", method: "GET", path: "/new", header: map[string]string{"Accept": "application/json"}, status: 401}, ""},
+	}
+	for _, tt := range challenges {
+		w := tt.test.run(t, f)
+		if got := w.Header().Get("WWW-Authenticate"); got != tt.want {
+			t.Errorf("%s: got WWW-Authenticate %q, want %q", tt.test.name, got, tt.want)
+		}
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	setup(t)
+	form := url.Values{"email": {"author@example.com"}, "password": {password}}.Encode()
+
+	tests := []struct {
+		name   string
+		tls    bool
+		header string
+		secure bool
+	}{
+		{"http", false, "", false},
+		{"https", true, "", true},
+		{"https proxy", false, "https", true},
+	}
+	for _, tt := range tests {
+		r := request("POST", "/login", form, "application/x-www-form-urlencoded")
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if len(tt.header) > 0 {
+			r.Header.Set("X-Forwarded-Proto", tt.header)
+		}
+		cookie := readCookie(serve(r))
+		if cookie == nil || cookie.Secure != tt.secure {
+			t.Errorf("%s: got cookie %v, want Secure %v", tt.name, cookie, tt.secure)
+		}
+	}
+}
+
+func TestErrorFormats(t *testing.T) {
+	f := setup(t)
+	missing := "/articles/" + bson.NewObjectId().Hex()
+
+	tests := []routeTest{
+		{name: "html", method: "GET", path: missing, status: 404, contains: "<html"},
+		{name: "json", method: "GET", path: missing, header: map[string]string{"Accept": "application/json"}, status: 404, contains: `{"error":{"status":404,"code":"not_found"`},
+		{name: "text", method: "GET", path: missing, header: map[string]string{"Accept": "text/plain"}, status: 404, contains: "404 not found\n"},
+		{name: "api default", method: "GET", path: "/api/v1" + missing, header: map[string]string{"Accept": "*/*"}, status: 404, contains: `"code":"not_found"`},
+		{name: "api html", method: "GET", path: "/api/v1" + missing, header: map[string]string{"Accept": "text/html"}, status: 404, contains: "<html"},
+	}
+	for _, tt := range tests {
+		tt.run(t, f)
+	}
+}
+
+func request(method, path, body, contentType string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if len(contentType) > 0 {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return r
+}
+
+func serve(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func readCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	r := http.Response{Header: w.Header()}
+	for _, cookie := range r.Cookies() {
+		return cookie
+	}
+	return nil
+}
+
+func TestBasePath(t *testing.T) {
+	backend, err := db.OpenMemory("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	articles, users := backend.Stores()
+	article := models.Article{Title: "Hello", Body: "Hello world"}
+	if err := articles.Create(&article); err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Name: "Author", Email: "author@example.com", Password: password}
+	if err := users.Create(&user); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/blog/", NewServer(Config{
+		BasePath:     "/blog",
+		TemplatesDir: "../templates/",
+		PublicDir:    "../public",
+		Articles:     articles,
+		Users:        users,
+	}))
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		status   int
+		location string
+		contains string
+	}{
+		{"home", "GET", "/blog/", "", 301, "/blog/articles", ""},
+		{"list", "GET", "/blog/articles", "", 200, "", `href="/blog/articles/` + article.Id.Hex() + `"`},
+		{"statics", "GET", "/blog/public/css/app.css", "", 200, "", ""},
+		{"require user", "GET", "/blog/new", "", 302, "/blog/login?next=%2Fblog%2Fnew", ""},
+		{"login", "POST", "/blog/login", "email=author@example.com&password=" + password, 302, "/blog/articles", ""},
+		{"outside", "GET", "/articles", "", 404, "", ""},
+	}
+	for _, tt := range tests {
+		r := request(tt.method, tt.path, tt.body, "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if w.Header().Get("Location") != tt.location {
+			t.Errorf("%s: got location %q, want %q", tt.name, w.Header().Get("Location"), tt.location)
+		}
+		if !strings.Contains(w.Body.String(), tt.contains) {
+			t.Errorf("%s: body does not contain %q", tt.name, tt.contains)
+		}
+		if cookie := readCookie(w); cookie != nil && cookie.Path != "/blog/" {
+			t.Errorf("%s: got cookie path %q, want /blog/", tt.name, cookie.Path)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	f := setup(t)
+
+	tests := []routeTest{
+		{name: "live", method: "GET", path: "/healthz", status: 200, contains: `"status":"ok"`},
+		{name: "ready", method: "GET", path: "/readyz", status: 200, contains: `"status":"ok"}`},
+		{name: "ready database", method: "GET", path: "/readyz", status: 200, contains: `"name":"database","status":"ok"`},
+		{name: "ready templates", method: "GET", path: "/readyz", status: 200, contains: `"name":"templates","status":"ok"`},
+	}
+	for _, tt := range tests {
+		tt.run(t, f)
+	}
+}
+
+func TestHealthDatabaseDown(t *testing.T) {
+	shared, session := db.Shared, db.Session
+	db.Shared, db.Session = nil, nil
+	defer func() { db.Shared, db.Session = shared, session }()
+
+	tests := []routeTest{
+		{name: "live", method: "GET", path: "/healthz", status: 200, contains: `"status":"ok"`},
+		{name: "ready", method: "GET", path: "/readyz", status: 503, contains: `"status":"unavailable"`},
+		{name: "ready database", method: "GET", path: "/readyz", status: 503, contains: `"name":"database","status":"failed"`},
+		{name: "ready templates", method: "GET", path: "/readyz", status: 503, contains: `"name":"templates","status":"ok"`},
+		{name: "page", method: "GET", path: "/articles", status: 503},
+	}
+	for _, tt := range tests {
+		tt.run(t, nil)
+	}
+}
+
+func TestFS(t *testing.T) {
+	backend, err := db.OpenMemory("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	articles, users := backend.Stores()
+
+	// Run from another directory, so that nothing is read from disk
+	wd, _ := os.Getwd()
+	fsys := os.DirFS(filepath.Dir(wd))
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, debug := range []bool{false, true} {
+		handler := NewServer(Config{FS: fsys, Debug: debug, Articles: articles, Users: users})
+
+		tests := []struct {
+			path     string
+			status   int
+			contains string
+		}{
+			{"/articles", 200, "<title>Go gin mgo demo | Articles</title>"},
+			{"/public/css/app.css", 200, ".article-body"},
+			{"/public/css/", 200, ""},
+			{"/public/missing.css", 404, ""},
+		}
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, request("GET", tt.path, "", ""))
+			if w.Code != tt.status {
+				t.Errorf("debug %v, %s: got status %d, want %d", debug, tt.path, w.Code, tt.status)
+			}
+			if !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("debug %v, %s: body does not contain %q", debug, tt.path, tt.contains)
+			}
+			if strings.Contains(w.Body.String(), "app.css</a>") {
+				t.Errorf("debug %v, %s: got a directory listing", debug, tt.path)
+			}
+		}
+	}
+}
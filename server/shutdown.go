@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// DrainTimeout is the default time in-flight requests get to finish once
+	// the server is asked to stop
+	DrainTimeout = 15 * time.Second
+
+	// CloseGrace is the time handlers still running after the drain timeout
+	// get to return once their connections are closed. The shutdown hooks,
+	// which close the database, run after it, so that writes of handlers
+	// running even longer may be lost.
+	CloseGrace = 5 * time.Second
+)
+
+var (
+	hooksMu sync.Mutex
+	hooks   []hook
+)
+
+// hook is a function run on shutdown
+type hook struct {
+	name string
+	fn   func() error
+}
+
+// OnShutdown registers a function to run once the server stopped and the
+// in-flight requests finished, e.g. to close the database. Hooks run in the
+// reverse order they were registered in.
+// Usage: server.OnShutdown("database", db.Close)
+func OnShutdown(name string, fn func() error) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, hook{name, fn})
+}
+
+// ListenAndServe serves the handler on the address until the process gets
+// SIGINT or SIGTERM. It then stops accepting connections, gives in-flight
+// requests up to drainTimeout to finish, closes the connections of the
+// others, waits up to CloseGrace for their handlers to return and runs the
+// shutdown hooks.
+func ListenAndServe(addr string, handler http.Handler, drainTimeout time.Duration) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	fmt.Println("Listening on", listener.Addr())
+	return serveUntil(listener, handler, drainTimeout, stop)
+}
+
+// serveUntil serves the handler on the listener until stop receives
+func serveUntil(listener net.Listener, handler http.Handler, drainTimeout time.Duration, stop <-chan os.Signal) error {
+	// Closing the server does not wait for the handlers, count them
+	var running int32
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		handler.ServeHTTP(w, r)
+	})}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		// The server failed before being asked to stop
+		runHooks()
+		return err
+	case sig := <-stop:
+		fmt.Printf("Got %v, draining requests for up to %v\n", sig, drainTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err == context.DeadlineExceeded {
+		fmt.Println("Requests did not finish in time, closing their connections")
+		err = srv.Close()
+		if !waitIdle(&running, CloseGrace) {
+			fmt.Println("Handlers did not return in time, their writes may be lost")
+		}
+	}
+
+	if hookErr := runHooks(); err == nil {
+		err = hookErr
+	}
+	return err
+}
+
+// waitIdle waits up to timeout for the count of running handlers to drop to
+// zero and reports whether it did
+func waitIdle(running *int32, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt32(running) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// runHooks runs the shutdown hooks, last registered first, and returns the
+// first error
+func runHooks() error {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+
+	var first error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].fn(); err != nil {
+			fmt.Printf("Shutdown of %s failed, go error %v\n", hooks[i].name, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	hooks = nil
+	return first
+}
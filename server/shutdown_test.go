@@ -0,0 +1,106 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServeUntil(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan bool)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	order := []string{}
+	OnShutdown("first", func() error {
+		order = append(order, "first")
+		return nil
+	})
+	OnShutdown("second", func() error {
+		order = append(order, "second")
+		return nil
+	})
+
+	stop := make(chan os.Signal, 1)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serveUntil(listener, handler, time.Second, stop)
+	}()
+
+	// Stop while a request is in flight, it must still complete
+	body := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		data, _ := ioutil.ReadAll(res.Body)
+		body <- string(data)
+	}()
+	<-started
+	stop <- syscall.SIGTERM
+
+	if got := <-body; got != "done" {
+		t.Errorf("got response %q, want done", got)
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("got error %v", err)
+	}
+	if len(order) != 2 || order[0] != "second" || order[1] != "first" {
+		t.Errorf("got hooks run in order %v, want [second first]", order)
+	}
+	if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Error("server still accepts connections")
+	}
+}
+
+func TestServeUntilDrainTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan bool)
+	var written int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		time.Sleep(300 * time.Millisecond)
+		atomic.StoreInt32(&written, 1)
+	})
+
+	// The database must only close once the handler returned
+	closed := int32(-1)
+	OnShutdown("database", func() error {
+		closed = atomic.LoadInt32(&written)
+		return nil
+	})
+
+	stop := make(chan os.Signal, 1)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serveUntil(listener, handler, 50*time.Millisecond, stop)
+	}()
+	go http.Get("http://" + listener.Addr().String())
+	<-started
+	stop <- syscall.SIGTERM
+
+	<-errs
+	if closed != 1 {
+		t.Error("the database was closed before the handler returned")
+	}
+}